@@ -0,0 +1,159 @@
+package fo
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// adaptiveTimeoutWindow is the number of the latest observations kept
+	// in the sketch of each invocation name.
+	adaptiveTimeoutWindow = 1000
+	// minAdaptiveTimeoutSamples is the number of the observations required
+	// before the timeout is derived from the sketch.
+	minAdaptiveTimeoutSamples = 20
+	// adaptiveTimeoutResortEvery is the number of the observations after
+	// which the sorted samples of the sketch are refreshed.
+	adaptiveTimeoutResortEvery = 32
+)
+
+var (
+	adaptiveSketchesMutex sync.Mutex
+	adaptiveSketches      = make(map[string]*latencySketch)
+)
+
+// latencySketch keeps the latest observations of the latency of an
+// invocation name in a ring buffer, and estimates the quantiles from
+// them.
+type latencySketch struct {
+	mutex   sync.Mutex
+	samples []time.Duration
+	next    int
+	sorted  []time.Duration
+	stale   int
+}
+
+// adaptiveSketch returns the sketch of the name, and creates it if not
+// exists.
+func adaptiveSketch(name string) *latencySketch {
+	adaptiveSketchesMutex.Lock()
+	defer adaptiveSketchesMutex.Unlock()
+
+	sketch, ok := adaptiveSketches[name]
+	if !ok {
+		sketch = &latencySketch{
+			samples: make([]time.Duration, 0, adaptiveTimeoutWindow),
+		}
+		adaptiveSketches[name] = sketch
+	}
+
+	return sketch
+}
+
+func (s *latencySketch) observe(latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.samples) < adaptiveTimeoutWindow {
+		s.samples = append(s.samples, latency)
+	} else {
+		s.samples[s.next] = latency
+	}
+
+	s.next = (s.next + 1) % adaptiveTimeoutWindow
+	s.stale++
+}
+
+// quantile returns the q-quantile of the observations, and false if there
+// are not enough observations yet. The sorted samples are refreshed every
+// 32 observations instead of on every call.
+func (s *latencySketch) quantile(q float64) (time.Duration, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.samples) < minAdaptiveTimeoutSamples {
+		return 0, false
+	}
+	if s.sorted == nil || s.stale >= adaptiveTimeoutResortEvery {
+		s.sorted = slices.Clone(s.samples)
+		slices.Sort(s.sorted)
+		s.stale = 0
+	}
+
+	index := int(math.Ceil(q*float64(len(s.sorted)))) - 1
+
+	return s.sorted[min(max(index, 0), len(s.sorted)-1)], true
+}
+
+// adaptiveTimeout derives the timeout of the invocations from the sketch
+// of their latency.
+type adaptiveTimeout struct {
+	sketch     *latencySketch
+	quantile   float64
+	multiplier float64
+	min        time.Duration
+	max        time.Duration
+	fallback   time.Duration
+}
+
+// timeout returns the q-quantile of the observed latency multiplied by
+// the multiplier and clamped to [min, max], or the fallback if there are
+// not enough observations yet.
+func (t *adaptiveTimeout) timeout() time.Duration {
+	latency, ok := t.sketch.quantile(t.quantile)
+	if !ok {
+		return t.fallback
+	}
+
+	timeout := time.Duration(float64(latency) * t.multiplier)
+	if t.max > 0 {
+		timeout = min(timeout, t.max)
+	}
+
+	return max(timeout, t.min)
+}
+
+// WithAdaptiveTimeout sets the timeout of each attempt of the invocation
+// derived from the latency observed for the name, instead of a hard-coded
+// one that is either too tight or too loose. The timeout is the
+// q-quantile (0 <= q <= 1) of the latest 1000 observations multiplied by
+// the multiplier and clamped to [minTimeout, maxTimeout], a zero
+// maxTimeout indicates no upper bound. It falls back to the static
+// fallback timeout until 20 invocations are observed.
+//
+// Only the latency of the succeeded attempts and the timed out ones are
+// observed, the latter with their timeouts so that the timeout grows back
+// when the latency goes up, while the failed attempts are not, since the
+// fast failures of an unhealthy dependency would otherwise tighten the
+// timeout.
+//
+//	user, err := fo.InvokeWithContext(ctx, getUser, fo.WithAdaptiveTimeout("users.get", 0.99, 1.5, 50*time.Millisecond, 5*time.Second, time.Second))
+//
+// It overrides the timeout of the policy in the registry, and is capped by
+// WithContextTimeout(...) if both are set.
+//
+// It panics if minTimeout is greater than a non-zero maxTimeout.
+func WithAdaptiveTimeout(name string, q, multiplier float64, minTimeout, maxTimeout, fallback time.Duration) CallInvokeWithOption {
+	if maxTimeout > 0 && minTimeout > maxTimeout {
+		panic("fo: WithAdaptiveTimeout requires minTimeout to be less than or equal to maxTimeout")
+	}
+
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeAdaptiveTimeout,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				adaptiveTimeout: &adaptiveTimeout{
+					sketch:     adaptiveSketch(name),
+					quantile:   q,
+					multiplier: multiplier,
+					min:        minTimeout,
+					max:        maxTimeout,
+					fallback:   fallback,
+				},
+				adaptiveTimeoutIsSet: true,
+			}
+		},
+	}
+}
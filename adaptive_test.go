@@ -0,0 +1,164 @@
+package fo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resetAdaptiveSketch drops the observations of the name, so that the
+// tests can be run multiple times with -count.
+func resetAdaptiveSketch(name string) {
+	adaptiveSketchesMutex.Lock()
+	defer adaptiveSketchesMutex.Unlock()
+
+	delete(adaptiveSketches, name)
+}
+
+func TestLatencySketch(t *testing.T) {
+	t.Parallel()
+
+	sketch := &latencySketch{}
+
+	for i := 1; i < minAdaptiveTimeoutSamples; i++ {
+		sketch.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	_, ok := sketch.quantile(0.5)
+	assert.False(t, ok)
+
+	for i := minAdaptiveTimeoutSamples; i <= 100; i++ {
+		sketch.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	latency, ok := sketch.quantile(0.99)
+	require.True(t, ok)
+	assert.Equal(t, 99*time.Millisecond, latency)
+
+	latency, ok = sketch.quantile(0.5)
+	require.True(t, ok)
+	assert.Equal(t, 50*time.Millisecond, latency)
+
+	// the oldest observations are dropped once the window is full
+	for range adaptiveTimeoutWindow {
+		sketch.observe(time.Second)
+	}
+
+	latency, ok = sketch.quantile(0)
+	require.True(t, ok)
+	assert.Equal(t, time.Second, latency)
+}
+
+func TestWithAdaptiveTimeout(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Timeout", func(t *testing.T) {
+		t.Parallel()
+		resetAdaptiveSketch("test.adaptive.timeout")
+
+		opts := []CallInvokeWithOption{
+			WithAdaptiveTimeout("test.adaptive.timeout", 0.99, 2, 5*time.Millisecond, time.Second, 500*time.Millisecond),
+		}
+
+		// falls back to the static timeout before enough observations
+		assert.Equal(t, 500*time.Millisecond, newInvokeWithOptions(opts...).attemptTimeout(nil))
+
+		for range minAdaptiveTimeoutSamples {
+			err := InvokeWith0(func() error {
+				return nil
+			}, opts...)
+			require.NoError(t, err)
+		}
+
+		// clamped to the min timeout
+		assert.Equal(t, 5*time.Millisecond, newInvokeWithOptions(opts...).attemptTimeout(nil))
+
+		sketch := adaptiveSketch("test.adaptive.timeout")
+		for range minAdaptiveTimeoutSamples * 10 {
+			sketch.observe(20 * time.Millisecond)
+		}
+
+		assert.Equal(t, 40*time.Millisecond, newInvokeWithOptions(opts...).attemptTimeout(nil))
+
+		// capped by the timeout of the call options
+		assert.Equal(t, 10*time.Millisecond, newInvokeWithOptions(append(opts, WithContextTimeout(10*time.Millisecond))...).attemptTimeout(nil))
+
+		err := InvokeWith0(func() error {
+			time.Sleep(time.Second)
+			return nil
+		}, opts...)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("Registry", func(t *testing.T) {
+		t.Parallel()
+		resetAdaptiveSketch("test.adaptive.registry")
+
+		r := NewRegistry()
+		r.Set("test.adaptive.registry", Policy{Timeout: Duration(time.Minute)})
+
+		options := newInvokeWithOptions(
+			WithName("test.adaptive.registry"),
+			WithRegistry(r),
+			WithAdaptiveTimeout("test.adaptive.registry", 0.99, 2, 0, 0, time.Second),
+		)
+		assert.Equal(t, time.Second, options.attemptTimeout(options.policy()))
+	})
+
+	t.Run("Grows", func(t *testing.T) {
+		t.Parallel()
+		resetAdaptiveSketch("test.adaptive.grows")
+
+		opts := []CallInvokeWithOption{
+			WithAdaptiveTimeout("test.adaptive.grows", 0.5, 2, 10*time.Millisecond, time.Second, time.Second),
+		}
+
+		sketch := adaptiveSketch("test.adaptive.grows")
+		for range minAdaptiveTimeoutSamples {
+			sketch.observe(time.Millisecond)
+		}
+
+		// the timed out attempts are observed with their timeouts
+		for range adaptiveTimeoutResortEvery {
+			err := InvokeWith0(func() error {
+				time.Sleep(100 * time.Millisecond)
+				return nil
+			}, opts...)
+			require.ErrorIs(t, err, context.DeadlineExceeded)
+		}
+
+		assert.GreaterOrEqual(t, newInvokeWithOptions(opts...).attemptTimeout(nil), 20*time.Millisecond)
+	})
+	t.Run("Failures", func(t *testing.T) {
+		t.Parallel()
+		resetAdaptiveSketch("test.adaptive.failures")
+
+		opts := []CallInvokeWithOption{
+			WithAdaptiveTimeout("test.adaptive.failures", 0.5, 2, 0, 0, time.Second),
+		}
+
+		// the fast failures are not observed
+		for range minAdaptiveTimeoutSamples {
+			err := InvokeWith0(func() error {
+				return assert.AnError
+			}, opts...)
+			require.ErrorIs(t, err, assert.AnError)
+		}
+
+		assert.Equal(t, time.Second, newInvokeWithOptions(opts...).attemptTimeout(nil))
+	})
+
+	t.Run("Bounds", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Panics(t, func() {
+			WithAdaptiveTimeout("test.adaptive.bounds", 0.99, 2, time.Second, time.Millisecond, time.Second)
+		})
+		assert.NotPanics(t, func() {
+			WithAdaptiveTimeout("test.adaptive.bounds", 0.99, 2, time.Second, 0, time.Second)
+		})
+	})
+}
@@ -0,0 +1,119 @@
+package fo
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ErrInsufficientTime is returned by the invocations with
+// WithMinRemaining(...), WithExpectedDuration(...) or
+// WithLatencyShedding(...) when the remaining time before the deadline of
+// the context is shorter than required, without calling the callback
+// function. It wraps context.DeadlineExceeded, so that it is treated as a
+// timeout.
+var ErrInsufficientTime = fmt.Errorf("fo: insufficient time before deadline: %w", context.DeadlineExceeded)
+
+const (
+	// minLatencySheddingSamples is the number of the observations of the
+	// invocation name required before the latency shedding starts, so that
+	// the first few invocations are not shed by an unreliable estimation.
+	minLatencySheddingSamples = 20
+)
+
+// WithMinRemaining refuses to start the invocation with ErrInsufficientTime
+// if the remaining time before the deadline of the context, including the
+// one set by WithContextTimeout(...), is shorter than d. The invocations
+// without deadlines are always started.
+func WithMinRemaining(d time.Duration) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeMinRemaining,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				minRemaining:      d,
+				minRemainingIsSet: true,
+			}
+		},
+	}
+}
+
+// WithExpectedDuration sets the expected duration of the callback
+// function, the invocation is refused with ErrInsufficientTime instead of
+// burning resources on the work that is doomed to time out, if the
+// remaining time before the deadline of the context is shorter than d.
+// The invocations without deadlines are always started.
+//
+// Combined with WithMinRemaining(...), the longer one of both is required.
+func WithExpectedDuration(d time.Duration) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeExpectedDuration,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				expectedDuration:      d,
+				expectedDurationIsSet: true,
+			}
+		},
+	}
+}
+
+// WithLatencyShedding sheds the named invocation with ErrInsufficientTime
+// if the remaining time before the deadline of the context is shorter
+// than the q-quantile of its latency observed by the histogram, which
+// must be registered as an observer by SetObservers(...) or
+// WithObservers(...) to observe the latency. The shedding starts after
+// 20 invocations with the same name are observed.
+//
+//	latency := fo.NewLatencyHistogram()
+//	fo.SetObservers(latency)
+//
+//	res, err := fo.InvokeWithContext(ctx, search, fo.WithName("search.query"), fo.WithLatencyShedding(latency, 0.9))
+//
+// Combined with WithMinRemaining(...) and WithExpectedDuration(...), the
+// longest one of them is required.
+func WithLatencyShedding(histogram *LatencyHistogram, q float64) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeLatencyShedding,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				sheddingHistogram:    histogram,
+				sheddingQuantile:     q,
+				latencySheddingIsSet: true,
+			}
+		},
+	}
+}
+
+// requiredRemaining returns the remaining time required to start the
+// invocation, zero if none is required.
+func (c *invocation) requiredRemaining() time.Duration {
+	required := max(c.minRemaining, c.expectedDuration)
+
+	if c.sheddingHistogram != nil && c.name != "" {
+		snapshot := c.sheddingHistogram.Snapshot(c.name)
+		if snapshot.Count >= minLatencySheddingSamples {
+			required = max(required, snapshot.Quantile(c.sheddingQuantile))
+		}
+	}
+
+	return required
+}
+
+// admitRemaining returns ErrInsufficientTime if the remaining time before
+// the deadline of ctx is shorter than required.
+func (c *invocation) admitRemaining(ctx context.Context) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+
+	required := c.requiredRemaining()
+	if required <= 0 {
+		return nil
+	}
+
+	if time.Until(deadline) >= required {
+		return nil
+	}
+
+	return ErrInsufficientTime
+}
@@ -0,0 +1,201 @@
+package fo
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithExpectedDuration(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Refused", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := InvokeWithContext0(ctx, func(context.Context) error {
+			calls.Add(1)
+			return nil
+		}, WithExpectedDuration(time.Second))
+		require.ErrorIs(t, err, ErrInsufficientTime)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Zero(t, calls.Load())
+
+		// the timeout of the call options counts as the deadline
+		err = InvokeWith0(func() error {
+			calls.Add(1)
+			return nil
+		}, WithContextTimeout(10*time.Millisecond), WithMinRemaining(20*time.Millisecond))
+		require.ErrorIs(t, err, ErrInsufficientTime)
+		assert.Zero(t, calls.Load())
+	})
+
+	t.Run("Admitted", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		res, err := InvokeWithContext(ctx, func(context.Context) (int, error) {
+			return 42, nil
+		}, WithExpectedDuration(10*time.Millisecond), WithMinRemaining(20*time.Millisecond))
+		require.NoError(t, err)
+		assert.Equal(t, 42, res)
+
+		// invocations without deadlines are always admitted
+		res, err = InvokeWith(func() (int, error) {
+			return 42, nil
+		}, WithExpectedDuration(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 42, res)
+	})
+
+	t.Run("Queued", func(t *testing.T) {
+		t.Parallel()
+
+		scheduler := NewScheduler(1)
+		release := make(chan struct{})
+		started := make(chan struct{})
+
+		go func() {
+			_ = InvokeWith0(func() error {
+				close(started)
+				<-release
+
+				return nil
+			}, WithScheduler(scheduler, "tenant-1"))
+		}()
+
+		<-started
+
+		time.AfterFunc(30*time.Millisecond, func() {
+			close(release)
+		})
+
+		var calls atomic.Int32
+
+		// admitted on arrival, but refused after waiting for the slot
+		err := InvokeWith0(func() error {
+			calls.Add(1)
+			return nil
+		}, WithScheduler(scheduler, "tenant-1"), WithContextTimeout(50*time.Millisecond), WithExpectedDuration(40*time.Millisecond))
+		require.ErrorIs(t, err, ErrInsufficientTime)
+		assert.Zero(t, calls.Load())
+		assert.Zero(t, scheduler.Stats()["tenant-1"].Running)
+	})
+
+	t.Run("Breaker", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewRegistry()
+		r.Set("test.admission.breaker", Policy{
+			Breaker: &BreakerPolicy{FailureThreshold: 1, OpenDuration: Duration(10 * time.Millisecond)},
+		})
+
+		scheduler := NewScheduler(1)
+
+		// opens the breaker
+		err := InvokeWith0(func() error {
+			return assert.AnError
+		}, WithName("test.admission.breaker"), WithRegistry(r))
+		require.ErrorIs(t, err, assert.AnError)
+
+		release := make(chan struct{})
+		started := make(chan struct{})
+
+		go func() {
+			_ = InvokeWith0(func() error {
+				close(started)
+				<-release
+
+				return nil
+			}, WithScheduler(scheduler, "tenant-1"))
+		}()
+
+		<-started
+		time.Sleep(20 * time.Millisecond)
+
+		time.AfterFunc(30*time.Millisecond, func() {
+			close(release)
+		})
+
+		// the trial call is refused after waiting for the slot
+		err = InvokeWith0(func() error {
+			return nil
+		}, WithName("test.admission.breaker"), WithRegistry(r), WithScheduler(scheduler, "tenant-1"),
+			WithContextTimeout(50*time.Millisecond), WithExpectedDuration(40*time.Millisecond))
+		require.ErrorIs(t, err, ErrInsufficientTime)
+
+		// the breaker lets the next trial call through instead of being
+		// stuck in half-open
+		err = InvokeWith0(func() error {
+			return nil
+		}, WithName("test.admission.breaker"), WithRegistry(r), WithScheduler(scheduler, "tenant-1"))
+		require.NoError(t, err)
+	})
+
+	t.Run("Retries", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewRegistry()
+		r.Set("test.admission.retries", Policy{Retries: 3})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		var attempts atomic.Int32
+
+		err := InvokeWithContext0(ctx, func(context.Context) error {
+			attempts.Add(1)
+			return nil
+		}, WithName("test.admission.retries"), WithRegistry(r), WithExpectedDuration(time.Second))
+		require.ErrorIs(t, err, ErrInsufficientTime)
+		assert.Zero(t, attempts.Load())
+	})
+}
+
+func TestWithLatencyShedding(t *testing.T) {
+	t.Parallel()
+
+	latency := NewLatencyHistogram(10*time.Millisecond, 100*time.Millisecond, time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var calls atomic.Int32
+
+	invoke := func() error {
+		return InvokeWithContext0(ctx, func(context.Context) error {
+			calls.Add(1)
+			return nil
+		}, WithName("test.shedding"), WithLatencyShedding(latency, 0.9))
+	}
+
+	// not shed before enough observations
+	for range minLatencySheddingSamples - 1 {
+		latency.Observe("test.shedding", 500*time.Millisecond)
+	}
+
+	require.NoError(t, invoke())
+	assert.Equal(t, int32(1), calls.Load())
+
+	latency.Observe("test.shedding", 500*time.Millisecond)
+
+	err := invoke()
+	require.ErrorIs(t, err, ErrInsufficientTime)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// other names are not affected
+	err = InvokeWithContext0(ctx, func(context.Context) error {
+		return nil
+	}, WithName("test.shedding.other"), WithLatencyShedding(latency, 0.9))
+	require.NoError(t, err)
+}
@@ -0,0 +1,223 @@
+package fo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrBatchKeyMissing is the error returned by Batcher.Load(...) when
+	// the results of the batch function do not contain the key.
+	ErrBatchKeyMissing = errors.New("fo: key missing from batch results")
+)
+
+const (
+	defaultBatcherWait         = time.Millisecond
+	defaultBatcherMaxBatchSize = 100
+)
+
+// BatchErrors is the error that the batch function of Batcher can return
+// to fail the individual keys, the keys not in it get their results as
+// usual.
+type BatchErrors[K comparable] map[K]error
+
+// Error implements the error interface.
+func (e BatchErrors[K]) Error() string {
+	return fmt.Sprintf("fo: batch failed for %d keys", len(e))
+}
+
+type batchResult[V any] struct {
+	value V
+	err   error
+}
+
+type batchRequest[K comparable, V any] struct {
+	ctx    context.Context
+	key    K
+	result chan batchResult[V]
+}
+
+// Batcher collects the individual Load(...) calls within a time window or
+// up to a max batch size, and loads them with a single call of the batch
+// function, in the style of the dataloaders, to avoid the N+1 queries.
+//
+// The batch function is invoked with InvokeWithContext(...) with the
+// options of the batcher, which means the timeouts and the policies in the
+// registry apply, and panics are recovered as *PanicError. The error of
+// the batch function is returned to all the callers, unless it is
+// BatchErrors, in which case only the keys in it fail.
+//
+//	users := fo.NewBatcher(func(ctx context.Context, ids []string) (map[string]*User, error) {
+//		return db.GetUsersByIDs(ctx, ids)
+//	}, fo.WithName("users.batch_get"), fo.WithContextTimeout(time.Second))
+//
+//	user, err := users.Load(ctx, id)
+type Batcher[K comparable, V any] struct {
+	fn           func(ctx context.Context, keys []K) (map[K]V, error)
+	opts         []CallInvokeWithOption
+	wait         time.Duration
+	maxBatchSize int
+
+	mutex      sync.Mutex
+	pending    []*batchRequest[K, V]
+	generation uint64
+}
+
+// NewBatcher creates a new Batcher with the batch function and the options
+// to invoke it with. The calls are collected for 1 millisecond or up to
+// 100 keys by default.
+func NewBatcher[K comparable, V any](fn func(ctx context.Context, keys []K) (map[K]V, error), opts ...CallInvokeWithOption) *Batcher[K, V] {
+	return &Batcher[K, V]{
+		fn:           fn,
+		opts:         opts,
+		wait:         defaultBatcherWait,
+		maxBatchSize: defaultBatcherMaxBatchSize,
+		pending:      make([]*batchRequest[K, V], 0),
+	}
+}
+
+// SetWait sets the time window to collect the calls in, which starts from
+// the first call of the batch.
+func (b *Batcher[K, V]) SetWait(wait time.Duration) *Batcher[K, V] {
+	b.wait = wait
+	return b
+}
+
+// SetMaxBatchSize sets the max number of the calls of a batch, the batch
+// is dispatched immediately once it is full. A non-positive size
+// indicates no limit.
+func (b *Batcher[K, V]) SetMaxBatchSize(size int) *Batcher[K, V] {
+	b.maxBatchSize = size
+	return b
+}
+
+// Load loads the value of the key with the batch that the call is
+// collected into. If ctx is done before the batch returns, Load returns
+// the error of ctx without failing the other calls of the batch.
+func (b *Batcher[K, V]) Load(ctx context.Context, key K) (V, error) {
+	req := &batchRequest[K, V]{
+		ctx:    ctx,
+		key:    key,
+		result: make(chan batchResult[V], 1),
+	}
+
+	b.mutex.Lock()
+	b.pending = append(b.pending, req)
+
+	if b.maxBatchSize > 0 && len(b.pending) >= b.maxBatchSize {
+		batch := b.take()
+		b.mutex.Unlock()
+
+		go b.run(batch)
+	} else {
+		if len(b.pending) == 1 {
+			generation := b.generation
+			time.AfterFunc(b.wait, func() {
+				b.flush(generation)
+			})
+		}
+
+		b.mutex.Unlock()
+	}
+
+	select {
+	case <-ctx.Done():
+		var zero V
+		return zero, contextError(ctx)
+	case res := <-req.result:
+		return res.value, res.err
+	}
+}
+
+// take takes the pending calls as a batch, must be called with the mutex
+// held.
+func (b *Batcher[K, V]) take() []*batchRequest[K, V] {
+	batch := b.pending
+	b.pending = make([]*batchRequest[K, V], 0)
+	b.generation++
+
+	return batch
+}
+
+// flush dispatches the pending calls when the time window of the batch of
+// the generation ends, unless the batch is already dispatched for being
+// full.
+func (b *Batcher[K, V]) flush(generation uint64) {
+	b.mutex.Lock()
+	if b.generation != generation {
+		b.mutex.Unlock()
+		return
+	}
+
+	batch := b.take()
+	b.mutex.Unlock()
+
+	b.run(batch)
+}
+
+// run calls the batch function with the keys of the calls that are still
+// waiting, and routes the results back to them.
+func (b *Batcher[K, V]) run(batch []*batchRequest[K, V]) {
+	var ctx context.Context
+
+	keys := make([]K, 0, len(batch))
+	seen := make(map[K]struct{}, len(batch))
+
+	for _, req := range batch {
+		if req.ctx.Err() != nil {
+			continue
+		}
+		if ctx == nil {
+			ctx = context.WithoutCancel(req.ctx)
+		}
+		if _, ok := seen[req.key]; ok {
+			continue
+		}
+
+		seen[req.key] = struct{}{}
+		keys = append(keys, req.key)
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	var values map[K]V
+
+	err := callWithPanicRecovery(func() error {
+		var err error
+
+		values, err = InvokeWithContext(ctx, func(ctx context.Context) (map[K]V, error) {
+			return b.fn(ctx, keys)
+		}, b.opts...)
+
+		return err
+	})
+
+	var keyErrs BatchErrors[K]
+	if errors.As(err, &keyErrs) {
+		err = nil
+	}
+
+	for _, req := range batch {
+		req.result <- b.result(req.key, values, err, keyErrs)
+	}
+}
+
+func (b *Batcher[K, V]) result(key K, values map[K]V, err error, keyErrs BatchErrors[K]) batchResult[V] {
+	if err != nil {
+		return batchResult[V]{err: err}
+	}
+	if keyErr, ok := keyErrs[key]; ok {
+		return batchResult[V]{err: keyErr}
+	}
+
+	value, ok := values[key]
+	if !ok {
+		return batchResult[V]{err: fmt.Errorf("%w: %v", ErrBatchKeyMissing, key)}
+	}
+
+	return batchResult[V]{value: value}
+}
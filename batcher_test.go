@@ -0,0 +1,178 @@
+package fo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadConcurrently[K comparable, V any](ctx context.Context, b *Batcher[K, V], keys ...K) ([]V, []error) {
+	var wg sync.WaitGroup
+
+	values := make([]V, len(keys))
+	errs := make([]error, len(keys))
+
+	for i, key := range keys {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			values[i], errs[i] = b.Load(ctx, key)
+		}()
+	}
+
+	wg.Wait()
+
+	return values, errs
+}
+
+func TestBatcher(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Batched", func(t *testing.T) {
+		t.Parallel()
+
+		calls := &testRecorder[[]int]{}
+
+		b := NewBatcher(func(_ context.Context, keys []int) (map[int]string, error) {
+			calls.record(slices.Sorted(slices.Values(keys)))
+
+			values := make(map[int]string, len(keys))
+			for _, key := range keys {
+				values[key] = "user-" + strconv.Itoa(key)
+			}
+
+			return values, nil
+		}).SetWait(20 * time.Millisecond)
+
+		values, errs := loadConcurrently(context.Background(), b, 1, 2, 3, 2)
+		assert.Equal(t, []string{"user-1", "user-2", "user-3", "user-2"}, values)
+		assert.Equal(t, make([]error, 4), errs)
+		assert.Equal(t, [][]int{{1, 2, 3}}, calls.snapshot())
+	})
+
+	t.Run("MaxBatchSize", func(t *testing.T) {
+		t.Parallel()
+
+		calls := &testRecorder[[]int]{}
+
+		b := NewBatcher(func(_ context.Context, keys []int) (map[int]int, error) {
+			calls.record(slices.Sorted(slices.Values(keys)))
+
+			values := make(map[int]int, len(keys))
+			for _, key := range keys {
+				values[key] = key * 10
+			}
+
+			return values, nil
+		}).SetWait(time.Hour).SetMaxBatchSize(2)
+
+		values, errs := loadConcurrently(context.Background(), b, 1, 2, 3, 4)
+		assert.Equal(t, []int{10, 20, 30, 40}, values)
+		assert.Equal(t, make([]error, 4), errs)
+		assert.Len(t, calls.snapshot(), 2)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		t.Parallel()
+
+		notFound := errors.New("not found")
+
+		b := NewBatcher(func(_ context.Context, keys []int) (map[int]int, error) {
+			return map[int]int{1: 10}, BatchErrors[int]{2: notFound}
+		}).SetWait(10 * time.Millisecond)
+
+		values, errs := loadConcurrently(context.Background(), b, 1, 2, 3)
+		assert.Equal(t, 10, values[0])
+		require.NoError(t, errs[0])
+		require.ErrorIs(t, errs[1], notFound)
+		require.ErrorIs(t, errs[2], ErrBatchKeyMissing)
+		assert.EqualError(t, errs[2], "fo: key missing from batch results: 3")
+
+		b = NewBatcher(func(_ context.Context, keys []int) (map[int]int, error) {
+			return nil, assert.AnError
+		}).SetWait(10 * time.Millisecond)
+
+		_, errs = loadConcurrently(context.Background(), b, 1, 2)
+		require.ErrorIs(t, errs[0], assert.AnError)
+		require.ErrorIs(t, errs[1], assert.AnError)
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		t.Parallel()
+
+		b := NewBatcher(func(_ context.Context, keys []int) (map[int]int, error) {
+			panic("something went wrong")
+		})
+
+		_, err := b.Load(context.Background(), 1)
+
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+		assert.Equal(t, "something went wrong", panicErr.Value)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		t.Parallel()
+
+		b := NewBatcher(func(ctx context.Context, keys []int) (map[int]int, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}, WithContextTimeout(10*time.Millisecond))
+
+		_, err := b.Load(context.Background(), 1)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		t.Parallel()
+
+		calls := &testRecorder[[]int]{}
+
+		b := NewBatcher(func(ctx context.Context, keys []int) (map[int]int, error) {
+			calls.record(slices.Sorted(slices.Values(keys)))
+			time.Sleep(50 * time.Millisecond)
+
+			return map[int]int{1: 10, 2: 20, 3: 30}, ctx.Err()
+		}).SetWait(20 * time.Millisecond)
+
+		canceledCtx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		timeoutCtx, cancelTimeout := context.WithTimeout(context.Background(), 40*time.Millisecond)
+		defer cancelTimeout()
+
+		var wg sync.WaitGroup
+
+		errs := make([]error, 3)
+		values := make([]int, 3)
+
+		for i, ctx := range []context.Context{context.Background(), canceledCtx, timeoutCtx} {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				values[i], errs[i] = b.Load(ctx, i+1)
+			}()
+		}
+
+		wg.Wait()
+
+		// the call leaving before the dispatch is not loaded, and the one
+		// leaving during the batch does not fail the others
+		assert.Equal(t, [][]int{{1, 3}}, calls.snapshot())
+		require.NoError(t, errs[0])
+		assert.Equal(t, 10, values[0])
+		require.ErrorIs(t, errs[1], context.Canceled)
+		require.ErrorIs(t, errs[2], context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,93 @@
+package fo
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCircuitOpen is the error returned by named invocations when the
+	// circuit breaker of its policy is open.
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+)
+
+type breakerState int
+
+const (
+	breakerStateClosed breakerState = iota
+	breakerStateOpen
+	breakerStateHalfOpen
+)
+
+// breaker is a consecutive failures based circuit breaker.
+//
+// It opens after FailureThreshold consecutive failures, rejects every
+// call during OpenDuration, and then lets a single trial call through,
+// the breaker will be closed if the trial call succeeded, or be opened
+// again otherwise.
+type breaker struct {
+	failureThreshold int
+	openDuration     time.Duration
+
+	mutex    sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	now      func() time.Time
+}
+
+// newBreaker creates a new breaker from the BreakerPolicy.
+func newBreaker(policy BreakerPolicy) *breaker {
+	failureThreshold := policy.FailureThreshold
+	if failureThreshold <= 0 {
+		failureThreshold = 1
+	}
+
+	return &breaker{
+		failureThreshold: failureThreshold,
+		openDuration:     policy.OpenDuration.Duration(),
+		now:              time.Now,
+	}
+}
+
+// allow reports whether a call is allowed to go through the breaker.
+// Every allowed call must be reported with done(...).
+func (b *breaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case breakerStateOpen:
+		if b.now().Sub(b.openedAt) < b.openDuration {
+			return false
+		}
+
+		b.state = breakerStateHalfOpen
+
+		return true
+	case breakerStateHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// done reports the result of an allowed call.
+func (b *breaker) done(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if err == nil {
+		b.state = breakerStateClosed
+		b.failures = 0
+
+		return
+	}
+
+	b.failures++
+	if b.state == breakerStateHalfOpen || b.failures >= b.failureThreshold {
+		b.state = breakerStateOpen
+		b.openedAt = b.now()
+	}
+}
@@ -0,0 +1,45 @@
+package fo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	b := newBreaker(BreakerPolicy{FailureThreshold: 2, OpenDuration: Duration(time.Second)})
+	b.now = func() time.Time { return now }
+
+	assert.True(t, b.allow())
+	b.done(assert.AnError)
+	assert.True(t, b.allow())
+	b.done(nil)
+
+	// consecutive failures only
+	assert.True(t, b.allow())
+	b.done(assert.AnError)
+	assert.True(t, b.allow())
+	b.done(assert.AnError)
+	assert.False(t, b.allow())
+
+	// half open, only one trial call is allowed
+	now = now.Add(time.Second)
+	assert.True(t, b.allow())
+	assert.False(t, b.allow())
+
+	// trial call failed, open again
+	b.done(assert.AnError)
+	assert.False(t, b.allow())
+
+	// trial call succeeded, closed
+	now = now.Add(time.Second)
+	assert.True(t, b.allow())
+	b.done(nil)
+	assert.True(t, b.allow())
+	assert.True(t, b.allow())
+}
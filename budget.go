@@ -0,0 +1,130 @@
+package fo
+
+import (
+	"context"
+	"time"
+)
+
+// Budget splits the time before a deadline across the sequential
+// invocations, e.g. of a request handler, so that the remaining time
+// doesn't need to be computed by hand. Every invocation takes a fraction
+// or a fixed slice of the time remaining when it starts, so that the time
+// left unused by the earlier invocations flows to the later ones, and the
+// overall deadline is always respected.
+//
+//	budget := fo.NewBudget(ctx)
+//
+//	user, err := fo.InvokeWithContext(ctx, getUser, budget.Fraction(0.3))
+//	orders, err := fo.InvokeWithContext(ctx, listOrders, budget.Fraction(0.5))
+//	err = budget.Invoke(1, render)
+type Budget struct {
+	ctx         context.Context
+	deadline    time.Time
+	hasDeadline bool
+}
+
+// NewBudget creates a new Budget of the time before the deadline of ctx.
+// The budget without deadline is unlimited, the fractions of it impose no
+// timeouts.
+func NewBudget(ctx context.Context) *Budget {
+	deadline, ok := ctx.Deadline()
+
+	return &Budget{
+		ctx:         ctx,
+		deadline:    deadline,
+		hasDeadline: ok,
+	}
+}
+
+// NewBudgetWithTimeout creates a new Budget of the total duration from now,
+// capped by the deadline of ctx if any.
+func NewBudgetWithTimeout(ctx context.Context, total time.Duration) *Budget {
+	deadline := time.Now().Add(total)
+	if parent, ok := ctx.Deadline(); ok && parent.Before(deadline) {
+		deadline = parent
+	}
+
+	return &Budget{
+		ctx:         ctx,
+		deadline:    deadline,
+		hasDeadline: true,
+	}
+}
+
+// Deadline returns the deadline of the budget, and false if the budget is
+// unlimited.
+func (b *Budget) Deadline() (time.Time, bool) {
+	return b.deadline, b.hasDeadline
+}
+
+// Remaining returns the time remaining before the deadline, which is zero
+// once the budget is exhausted, and -1 if the budget is unlimited.
+func (b *Budget) Remaining() time.Duration {
+	if !b.hasDeadline {
+		return -1
+	}
+
+	return max(time.Until(b.deadline), 0)
+}
+
+// Fraction sets the timeout of the invocation to the fraction (0 < f <= 1)
+// of the time remaining when the invocation starts.
+func (b *Budget) Fraction(f float64) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeContextTimeout,
+		options: func() *invokeWithOptions {
+			if !b.hasDeadline {
+				return &invokeWithOptions{}
+			}
+
+			return budgetTimeout(time.Duration(float64(b.Remaining()) * f))
+		},
+	}
+}
+
+// Slice sets the timeout of the invocation to d, capped by the time
+// remaining when the invocation starts.
+func (b *Budget) Slice(d time.Duration) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeContextTimeout,
+		options: func() *invokeWithOptions {
+			if !b.hasDeadline {
+				return budgetTimeout(d)
+			}
+
+			return budgetTimeout(min(d, b.Remaining()))
+		},
+	}
+}
+
+// budgetTimeout returns the options with the timeout, the timeout of the
+// exhausted budget is set to the shortest one instead of zero, which
+// indicates no timeout.
+func budgetTimeout(timeout time.Duration) *invokeWithOptions {
+	return &invokeWithOptions{
+		contextTimeout:      max(timeout, time.Nanosecond),
+		contextTimeoutIsSet: true,
+	}
+}
+
+// Invoke invokes fn with the context of the budget as parent context and
+// the timeout of the fraction of the remaining time. It returns
+// context.DeadlineExceeded without calling fn if the budget is exhausted.
+func (b *Budget) Invoke(f float64, fn func(ctx context.Context) error, opts ...CallInvokeWithOption) error {
+	return b.invoke(b.Fraction(f), fn, opts...)
+}
+
+// InvokeSlice invokes fn with the context of the budget as parent context
+// and the timeout of d capped by the remaining time. It returns
+// context.DeadlineExceeded without calling fn if the budget is exhausted.
+func (b *Budget) InvokeSlice(d time.Duration, fn func(ctx context.Context) error, opts ...CallInvokeWithOption) error {
+	return b.invoke(b.Slice(d), fn, opts...)
+}
+
+func (b *Budget) invoke(timeout CallInvokeWithOption, fn func(ctx context.Context) error, opts ...CallInvokeWithOption) error {
+	if b.Remaining() == 0 {
+		return context.DeadlineExceeded
+	}
+
+	return InvokeWithContext0(b.ctx, fn, append(append(make([]CallInvokeWithOption, 0, len(opts)+1), opts...), timeout)...)
+}
@@ -0,0 +1,137 @@
+package fo
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudget(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Fraction", func(t *testing.T) {
+		t.Parallel()
+
+		budget := NewBudgetWithTimeout(context.Background(), time.Second)
+
+		deadline, ok := budget.Deadline()
+		require.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(time.Second), deadline, 10*time.Millisecond)
+
+		var timeouts []time.Duration
+
+		record := func(ctx context.Context) error {
+			deadline, ok := ctx.Deadline()
+			require.True(t, ok)
+
+			timeouts = append(timeouts, time.Until(deadline))
+
+			return nil
+		}
+
+		require.NoError(t, budget.Invoke(0.3, func(ctx context.Context) error {
+			time.Sleep(100 * time.Millisecond)
+			return record(ctx)
+		}))
+		require.NoError(t, budget.Invoke(0.5, record))
+
+		// the timeout of the call options is respected if shorter
+		require.NoError(t, budget.Invoke(1, record, WithContextTimeout(100*time.Millisecond)))
+
+		require.Len(t, timeouts, 3)
+		assert.InDelta(t, 200*time.Millisecond, timeouts[0], float64(20*time.Millisecond))
+		// the unused time flows to the later invocations
+		assert.InDelta(t, 450*time.Millisecond, timeouts[1], float64(20*time.Millisecond))
+		assert.InDelta(t, 100*time.Millisecond, timeouts[2], float64(20*time.Millisecond))
+	})
+
+	t.Run("Slice", func(t *testing.T) {
+		t.Parallel()
+
+		budget := NewBudgetWithTimeout(context.Background(), 50*time.Millisecond)
+
+		err := budget.InvokeSlice(20*time.Millisecond, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// capped by the overall deadline
+		start := time.Now()
+
+		res, err := InvokeWith(func() (int, error) {
+			time.Sleep(time.Second)
+			return 42, nil
+		}, budget.Slice(time.Second))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Zero(t, res)
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+		var calls atomic.Int32
+
+		err = budget.Invoke(0.5, func(context.Context) error {
+			calls.Add(1)
+			return nil
+		})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Zero(t, calls.Load())
+		assert.Zero(t, budget.Remaining())
+
+		// the exhausted budget still imposes the timeout
+		err = InvokeWith0(func() error {
+			time.Sleep(time.Second)
+			return nil
+		}, budget.Fraction(0.5))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		budget := NewBudget(ctx)
+		assert.InDelta(t, 100*time.Millisecond, budget.Remaining(), float64(20*time.Millisecond))
+
+		// capped by the deadline of the parent context
+		budget = NewBudgetWithTimeout(ctx, time.Hour)
+		assert.InDelta(t, 100*time.Millisecond, budget.Remaining(), float64(20*time.Millisecond))
+
+		cancel()
+
+		err := budget.Invoke(0.5, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		t.Parallel()
+
+		budget := NewBudget(context.Background())
+
+		_, ok := budget.Deadline()
+		assert.False(t, ok)
+		assert.Equal(t, time.Duration(-1), budget.Remaining())
+
+		err := budget.Invoke(0.5, func(ctx context.Context) error {
+			_, ok := ctx.Deadline()
+			assert.False(t, ok)
+
+			return nil
+		})
+		require.NoError(t, err)
+
+		err = budget.InvokeSlice(10*time.Millisecond, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,278 @@
+package fo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	runningInvocations    sync.Map
+	runningInvocationSeed atomic.Uint64
+	debugTracking         atomic.Bool
+)
+
+// SetDebugTracking enables or disables the tracking of the running
+// callback goroutines listed by RunningInvocations(...) and
+// DebugHandler(). It is disabled by default, since the tracking costs
+// every invocation, and enabled by DebugHandler(). Only the invocations
+// started while it is enabled are listed.
+func SetDebugTracking(enabled bool) {
+	debugTracking.Store(enabled)
+}
+
+// RunningInvocation is the snapshot of a callback goroutine that is still
+// running.
+type RunningInvocation struct {
+	// ID is the unique ID of the invocation in the process.
+	ID uint64 `json:"id"`
+	// Name is the name of the invocation set by WithName(...).
+	Name string `json:"name,omitempty"`
+	// Caller is the call site of the invocation.
+	Caller string `json:"caller"`
+	// Start is the time when the callback goroutine was started.
+	Start time.Time `json:"start"`
+	// Age is the duration since Start.
+	Age Duration `json:"age"`
+	// Deadline is the deadline of the invocation context, nil if there is
+	// none.
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// Abandoned reports whether the caller has already left due to the
+	// context is done.
+	Abandoned bool `json:"abandoned"`
+	// GoroutineID is the ID of the callback goroutine.
+	GoroutineID int64 `json:"goroutineId"`
+	// Stack is the current stack trace of the callback goroutine.
+	Stack string `json:"stack,omitempty"`
+}
+
+// runningInvocation tracks a running callback goroutine.
+type runningInvocation struct {
+	id          uint64
+	name        string
+	caller      string
+	start       time.Time
+	deadline    time.Time
+	goroutineID atomic.Int64
+	abandoned   atomic.Bool
+}
+
+// trackInvocation starts tracking the callback goroutine of call, the
+// returned function should be called when the callback goroutine exits.
+// It returns nil if the callback goroutine is inspected by none of the
+// debug tracking, the tracker, the watchdog and the timeout stack capture,
+// so that the invocations pay nothing for them when they are disabled.
+func trackInvocation(ctx context.Context, call *invocation, start time.Time, tracked bool) (*runningInvocation, func()) {
+	debugging := debugTracking.Load()
+	if !debugging && !tracked && !call.captureTimeoutStack && call.watchdogInterval <= 0 {
+		return nil, func() {}
+	}
+
+	running := &runningInvocation{
+		id:     runningInvocationSeed.Add(1),
+		name:   call.name,
+		caller: call.caller,
+		start:  start,
+	}
+
+	deadline, ok := ctx.Deadline()
+	if ok {
+		running.deadline = deadline
+	}
+
+	if !debugging {
+		return running, func() {}
+	}
+
+	runningInvocations.Store(running.id, running)
+
+	return running, func() {
+		runningInvocations.Delete(running.id)
+	}
+}
+
+// snapshot returns the snapshot of the running invocation, the stack
+// trace is looked up from stacks if it is not nil.
+func (r *runningInvocation) snapshot(now time.Time, stacks map[int64]string) RunningInvocation {
+	snapshot := RunningInvocation{
+		ID:          r.id,
+		Name:        r.name,
+		Caller:      r.caller,
+		Start:       r.start,
+		Age:         Duration(now.Sub(r.start)),
+		Abandoned:   r.abandoned.Load(),
+		GoroutineID: r.goroutineID.Load(),
+	}
+	if !r.deadline.IsZero() {
+		deadline := r.deadline
+		snapshot.Deadline = &deadline
+	}
+	if stacks != nil {
+		snapshot.Stack = stacks[snapshot.GoroutineID]
+	}
+
+	return snapshot
+}
+
+// RunningInvocations returns the snapshots of the callback goroutines
+// that are still running, including the abandoned ones, in the order they
+// started. The stack traces are included if withStacks is true. Only the
+// invocations started while SetDebugTracking(true) is in effect are
+// listed.
+func RunningInvocations(withStacks bool) []RunningInvocation {
+	var stacks map[int64]string
+	if withStacks {
+		stacks = goroutineStacks()
+	}
+
+	now := time.Now()
+	invocations := make([]RunningInvocation, 0)
+
+	runningInvocations.Range(func(_, value any) bool {
+		running, _ := value.(*runningInvocation)
+		invocations = append(invocations, running.snapshot(now, stacks))
+
+		return true
+	})
+
+	sort.Slice(invocations, func(i, j int) bool {
+		return invocations[i].ID < invocations[j].ID
+	})
+
+	return invocations
+}
+
+// currentGoroutineID parses the ID of the current goroutine from the
+// header of its stack trace, which looks like "goroutine 18 [running]:".
+func currentGoroutineID() int64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+
+	return parseGoroutineID(buf)
+}
+
+func parseGoroutineID(stack []byte) int64 {
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+
+	end := bytes.IndexByte(stack, ' ')
+	if end < 0 {
+		return 0
+	}
+
+	id, err := strconv.ParseInt(string(stack[:end]), 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return id
+}
+
+// allGoroutineStacks returns the stack traces of all goroutines.
+func allGoroutineStacks() []byte {
+	buf := make([]byte, 64<<10)
+
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// goroutineStacks returns the stack traces of all goroutines by their IDs.
+func goroutineStacks() map[int64]string {
+	stacks := make(map[int64]string)
+
+	for _, stack := range strings.Split(string(allGoroutineStacks()), "\n\n") {
+		id := parseGoroutineID([]byte(stack))
+		if id != 0 {
+			stacks[id] = strings.TrimSpace(stack)
+		}
+	}
+
+	return stacks
+}
+
+var debugTemplate = template.Must(template.New("fo").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>fo invocations</title>
+<style>
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+tr.abandoned { background: #fdd; }
+pre { margin: 0; }
+</style>
+</head>
+<body>
+<h1>fo invocations</h1>
+<p>{{len .}} running invocation(s). <a href="?format=json">JSON</a></p>
+<table>
+<tr><th>ID</th><th>Name</th><th>Caller</th><th>Start</th><th>Age</th><th>Deadline</th><th>Abandoned</th><th>Stack</th></tr>
+{{range .}}<tr{{if .Abandoned}} class="abandoned"{{end}}>
+<td>{{.ID}}</td>
+<td>{{.Name}}</td>
+<td>{{.Caller}}</td>
+<td>{{.Start.Format "2006-01-02T15:04:05.000Z07:00"}}</td>
+<td>{{.Age.Duration}}</td>
+<td>{{with .Deadline}}{{.Format "2006-01-02T15:04:05.000Z07:00"}}{{end}}</td>
+<td>{{.Abandoned}}</td>
+<td><details><summary>goroutine {{.GoroutineID}}</summary><pre>{{.Stack}}</pre></details></td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// DebugHandler returns an http.Handler in the style of /debug/pprof that
+// renders the callback goroutines that are still running, including the
+// abandoned ones whose callers have already timed out, with their name,
+// call site, start time, age, deadline and current stack trace. It helps
+// to find out which callbacks are stuck and where.
+//
+// The table is rendered as HTML by default, and as JSON if the query
+// parameter format=json is set or the Accept header prefers
+// application/json. The query parameter stacks=0 omits the stack traces.
+//
+// It enables the debug tracking by SetDebugTracking(true), the
+// invocations started before it is created are not listed.
+//
+//	http.Handle("/debug/fo", fo.DebugHandler())
+func DebugHandler() http.Handler {
+	SetDebugTracking(true)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		invocations := RunningInvocations(r.URL.Query().Get("stacks") != "0")
+
+		format := r.URL.Query().Get("format")
+		if format == "" && strings.HasPrefix(r.Header.Get("Accept"), "application/json") {
+			format = "json"
+		}
+
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		if format == "json" {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+			_ = json.NewEncoder(w).Encode(invocations)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		_ = debugTemplate.Execute(w, invocations)
+	})
+}
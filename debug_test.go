@@ -0,0 +1,127 @@
+package fo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func findRunningInvocation(invocations []RunningInvocation, name string) (RunningInvocation, bool) {
+	for _, invocation := range invocations {
+		if invocation.Name == name {
+			return invocation, true
+		}
+	}
+
+	return RunningInvocation{}, false
+}
+
+func blockedInDebugTest(release <-chan struct{}) {
+	<-release
+}
+
+func TestParseGoroutineID(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, int64(18), parseGoroutineID([]byte("goroutine 18 [running]:\nmain.main()")))
+	assert.Equal(t, int64(0), parseGoroutineID([]byte("goroutine")))
+	assert.Equal(t, int64(0), parseGoroutineID([]byte("goroutine abc [running]:")))
+	assert.NotZero(t, currentGoroutineID())
+}
+
+func TestDebugHandler(t *testing.T) {
+	t.Parallel()
+
+	SetDebugTracking(true)
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+
+	defer close(release)
+
+	go func() {
+		_ = InvokeWith0(func() error {
+			started <- struct{}{}
+			blockedInDebugTest(release)
+
+			return nil
+		}, WithName("test.debug.running"))
+	}()
+
+	err := InvokeWith0(func() error {
+		started <- struct{}{}
+		blockedInDebugTest(release)
+
+		return nil
+	}, WithName("test.debug.abandoned"), WithContextTimeout(10*time.Millisecond))
+	require.Error(t, err)
+
+	<-started
+	<-started
+
+	t.Run("RunningInvocations", func(t *testing.T) {
+		invocations := RunningInvocations(true)
+
+		running, ok := findRunningInvocation(invocations, "test.debug.running")
+		require.True(t, ok)
+		assert.False(t, running.Abandoned)
+		assert.Nil(t, running.Deadline)
+		assert.Contains(t, running.Caller, "fo.TestDebugHandler.func1:")
+		assert.NotZero(t, running.GoroutineID)
+		assert.Contains(t, running.Stack, "blockedInDebugTest")
+
+		abandoned, ok := findRunningInvocation(invocations, "test.debug.abandoned")
+		require.True(t, ok)
+		assert.True(t, abandoned.Abandoned)
+		require.NotNil(t, abandoned.Deadline)
+		assert.GreaterOrEqual(t, abandoned.Age.Duration(), 10*time.Millisecond)
+		assert.Contains(t, abandoned.Stack, "blockedInDebugTest")
+
+		withoutStacks, ok := findRunningInvocation(RunningInvocations(false), "test.debug.running")
+		require.True(t, ok)
+		assert.Empty(t, withoutStacks.Stack)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		DebugHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/fo?format=json", nil))
+
+		assert.Equal(t, "application/json; charset=utf-8", recorder.Header().Get("Content-Type"))
+
+		var invocations []RunningInvocation
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &invocations))
+
+		abandoned, ok := findRunningInvocation(invocations, "test.debug.abandoned")
+		require.True(t, ok)
+		assert.True(t, abandoned.Abandoned)
+		assert.Contains(t, abandoned.Stack, "blockedInDebugTest")
+
+		request := httptest.NewRequest(http.MethodGet, "/debug/fo?stacks=0", nil)
+		request.Header.Set("Accept", "application/json")
+
+		recorder = httptest.NewRecorder()
+		DebugHandler().ServeHTTP(recorder, request)
+
+		invocations = nil
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &invocations))
+
+		running, ok := findRunningInvocation(invocations, "test.debug.running")
+		require.True(t, ok)
+		assert.Empty(t, running.Stack)
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		DebugHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/fo", nil))
+
+		assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+		assert.Contains(t, recorder.Body.String(), "<td>test.debug.running</td>")
+		assert.Contains(t, recorder.Body.String(), `<tr class="abandoned">`)
+		assert.Contains(t, recorder.Body.String(), "blockedInDebugTest")
+	})
+}
@@ -0,0 +1,196 @@
+package fo
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInjectedFault is the error injected by FaultInjector when
+	// Fault.Error is not set.
+	ErrInjectedFault = errors.New("injected fault")
+)
+
+var (
+	faultInjectorMutex  = sync.RWMutex{}
+	globalFaultInjector *FaultInjector
+)
+
+// SetFaultInjector sets the global FaultInjector that applies to every
+// invocation made by InvokeWith* and InvokeWithTimeout*, passing nil
+// disables the global fault injection. It is meant to be used in tests.
+//
+// NOTICE: This function will replace the global existing fault injector
+// on package fo level.
+func SetFaultInjector(injector *FaultInjector) {
+	faultInjectorMutex.Lock()
+	defer faultInjectorMutex.Unlock()
+
+	globalFaultInjector = injector
+}
+
+func currentFaultInjector() *FaultInjector {
+	faultInjectorMutex.RLock()
+	defer faultInjectorMutex.RUnlock()
+
+	return globalFaultInjector
+}
+
+// Fault describes the faults to inject into the matched invocations.
+// Each kind of fault is injected independently with its own probability
+// in the range of [0, 1], a probability of 0 never injects the fault and
+// a probability of 1 always injects it.
+//
+// The latency is injected before the callback function is called, and
+// is counted against the timeout of the invocation. An injected panic
+// takes precedence over an injected error, the callback function will
+// not be called if either of them is injected.
+type Fault struct {
+	Latency            time.Duration
+	LatencyProbability float64
+
+	Error            error
+	ErrorProbability float64
+
+	Panic            any
+	PanicProbability float64
+}
+
+type faultRule struct {
+	match func(name string) bool
+	fault Fault
+}
+
+// injectedFault is the decision made for a single invocation.
+type injectedFault struct {
+	latency time.Duration
+	err     error
+	panic   any
+}
+
+// FaultInjector injects latency, errors and panics into invocations for
+// chaos and resilience testing. The decisions are made with a seeded
+// random source, so the same sequence of invocations always gets the
+// same faults.
+//
+// Enable it per call with WithFaultInjection(...), or globally with
+// SetFaultInjector(...).
+type FaultInjector struct {
+	mutex sync.Mutex
+	rand  *rand.Rand
+	rules []faultRule
+}
+
+// NewFaultInjector creates a new FaultInjector with the random source
+// seeded with seed.
+func NewFaultInjector(seed int64) *FaultInjector {
+	return &FaultInjector{
+		rand:  rand.New(rand.NewSource(seed)), //nolint:gosec
+		rules: make([]faultRule, 0),
+	}
+}
+
+// ForName injects the fault into the invocations named with name by
+// WithName(...).
+func (f *FaultInjector) ForName(name string, fault Fault) *FaultInjector {
+	return f.ForPredicate(func(n string) bool {
+		return n == name
+	}, fault)
+}
+
+// ForPredicate injects the fault into the invocations whose name matches
+// the predicate, the name is empty for unnamed invocations.
+func (f *FaultInjector) ForPredicate(predicate func(name string) bool, fault Fault) *FaultInjector {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.rules = append(f.rules, faultRule{match: predicate, fault: fault})
+
+	return f
+}
+
+// ForAll injects the fault into all the invocations.
+func (f *FaultInjector) ForAll(fault Fault) *FaultInjector {
+	return f.ForPredicate(func(string) bool {
+		return true
+	}, fault)
+}
+
+// decide makes the decision of the faults to inject for the invocation
+// with name, the first matched rule wins. The random source is always
+// advanced by exactly three draws for a matched invocation to keep the
+// decisions reproducible.
+func (f *FaultInjector) decide(name string) (injectedFault, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, rule := range f.rules {
+		if !rule.match(name) {
+			continue
+		}
+
+		latencyRoll := f.rand.Float64()
+		errorRoll := f.rand.Float64()
+		panicRoll := f.rand.Float64()
+
+		var decision injectedFault
+		if latencyRoll < rule.fault.LatencyProbability {
+			decision.latency = rule.fault.Latency
+		}
+		if errorRoll < rule.fault.ErrorProbability {
+			decision.err = rule.fault.Error
+			if decision.err == nil {
+				decision.err = ErrInjectedFault
+			}
+		}
+		if panicRoll < rule.fault.PanicProbability {
+			decision.panic = rule.fault.Panic
+			if decision.panic == nil {
+				decision.panic = ErrInjectedFault
+			}
+		}
+
+		return decision, true
+	}
+
+	return injectedFault{}, false
+}
+
+// injectFault wraps fn with the faults decided by the injector for the
+// invocation with name.
+func injectFault[R any](injector *FaultInjector, name string, fn func(ctx context.Context) (R, error)) func(ctx context.Context) (R, error) {
+	if injector == nil {
+		return fn
+	}
+
+	decision, ok := injector.decide(name)
+	if !ok {
+		return fn
+	}
+
+	return func(ctx context.Context) (R, error) {
+		var empty R
+
+		if decision.latency > 0 {
+			timer := time.NewTimer(decision.latency)
+
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return empty, contextError(ctx)
+			case <-timer.C:
+			}
+		}
+		if decision.panic != nil {
+			panic(decision.panic)
+		}
+		if decision.err != nil {
+			return empty, decision.err
+		}
+
+		return fn(ctx)
+	}
+}
@@ -0,0 +1,125 @@
+package fo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultInjector(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Deterministic", func(t *testing.T) {
+		t.Parallel()
+
+		run := func() []bool {
+			injector := NewFaultInjector(42).ForAll(Fault{ErrorProbability: 0.5})
+
+			results := make([]bool, 0, 20)
+			for i := 0; i < 20; i++ {
+				err := InvokeWith0(func() error {
+					return nil
+				}, WithFaultInjection(injector))
+
+				results = append(results, errors.Is(err, ErrInjectedFault))
+			}
+
+			return results
+		}
+
+		first := run()
+		assert.Equal(t, first, run())
+		assert.Contains(t, first, true)
+		assert.Contains(t, first, false)
+	})
+
+	t.Run("Latency", func(t *testing.T) {
+		t.Parallel()
+
+		injector := NewFaultInjector(1).ForName("slow", Fault{
+			Latency:            time.Second,
+			LatencyProbability: 1,
+		})
+
+		tracker := NewTracker(0)
+
+		start := time.Now()
+		res, err := InvokeWith(func() (string, error) {
+			return "foo", nil
+		}, WithContextTimeout(10*time.Millisecond), WithName("slow"), WithFaultInjection(injector), WithTracker(tracker))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Empty(t, res)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+		// the injected latency stops once the context is done, instead of
+		// leaving the callback goroutine sleeping
+		assert.Eventually(t, func() bool {
+			return tracker.InFlight() == 0
+		}, 500*time.Millisecond, 5*time.Millisecond)
+
+		// other names are not affected
+		res, err = InvokeWith(func() (string, error) {
+			return "foo", nil
+		}, WithContextTimeout(10*time.Millisecond), WithName("fast"), WithFaultInjection(injector))
+		require.NoError(t, err)
+		assert.Equal(t, "foo", res)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Parallel()
+
+		injector := NewFaultInjector(1).ForPredicate(func(name string) bool {
+			return strings.HasPrefix(name, "payments.")
+		}, Fault{
+			Error:            assert.AnError,
+			ErrorProbability: 1,
+		})
+
+		called := false
+
+		err := InvokeWith0(func() error {
+			called = true
+			return nil
+		}, WithName("payments.charge"), WithFaultInjection(injector))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.False(t, called)
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		t.Parallel()
+
+		injector := NewFaultInjector(1).ForAll(Fault{
+			Panic:            "injected",
+			PanicProbability: 1,
+		})
+
+		err := callWithPanicRecovery(func() error {
+			return InvokeWith0(func() error {
+				return nil
+			}, WithFaultInjection(injector))
+		})
+		require.Error(t, err)
+
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+		assert.Equal(t, "panic: injected", panicErr.Error())
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+
+		injector := NewFaultInjector(1).ForAll(Fault{ErrorProbability: 1})
+
+		err := InvokeWith0(func() error {
+			return nil
+		}, WithFaultInjection(injector), WithFaultInjection(nil))
+		require.NoError(t, err)
+	})
+}
@@ -2,9 +2,32 @@ package fo
 
 import (
 	"os"
+	"sync"
 	"testing"
 )
 
 func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
+
+// testRecorder records the values in order, which may be recorded
+// concurrently, e.g. by the callback goroutines or the handlers.
+type testRecorder[T any] struct {
+	mutex  sync.Mutex
+	values []T
+}
+
+func (r *testRecorder[T]) record(value T) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.values = append(r.values, value)
+}
+
+// snapshot returns a copy of the values recorded so far.
+func (r *testRecorder[T]) snapshot() []T {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]T(nil), r.values...)
+}
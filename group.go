@@ -0,0 +1,167 @@
+package fo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Group is a collection of goroutines working on subtasks that are part
+// of the same overall task, behaves like golang.org/x/sync/errgroup.Group
+// with panic recovery built in.
+//
+// By default, Wait returns the first error returned by the goroutines.
+// Once CollectAll is called, every error will be collected into the
+// group's own mayHandlers instead, the handlers registered by Use(...)
+// will be called for each of them, and the collected errors can be
+// extracted with CollectAsError, CollectAsErrors, HandleErrors, etc. just
+// like MayInvoker.
+type Group struct {
+	*mayHandlers
+
+	cancel     context.CancelCauseFunc
+	wg         sync.WaitGroup
+	sem        chan struct{}
+	collectAll bool
+
+	errOnce sync.Once
+	err     error
+}
+
+// NewGroup creates a new Group. A zero value Group is not valid, use
+// NewGroup or NewGroupWithContext instead.
+func NewGroup() *Group {
+	return &Group{
+		mayHandlers: newMayHandlers(),
+	}
+}
+
+// NewGroupWithContext creates a new Group and an associated context
+// derived from ctx.
+//
+// The derived context is canceled the first time a function passed to
+// Go returns a non-nil error or panics, or the first time Wait returns,
+// whichever occurs first.
+func NewGroupWithContext(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	g := NewGroup()
+	g.cancel = cancel
+
+	return g, ctx
+}
+
+// Use registers the handlers.
+func (g *Group) Use(handler ...MayHandler) *Group {
+	g.mayHandlers.Use(handler...)
+	return g
+}
+
+// CollectAll enables the collect-all mode of the group, every error
+// returned by the goroutines will be handled by the handlers registered
+// by Use(...) and collected, and Wait will return all of them combined
+// with multierr.Combine().
+func (g *Group) CollectAll() *Group {
+	g.collectAll = true
+	return g
+}
+
+// SetLimit limits the number of active goroutines in this group to at
+// most n. A negative value indicates no limit.
+//
+// Any subsequent call to the Go method will block until it can add an
+// active goroutine without exceeding the configured limit.
+//
+// The limit must not be modified while any goroutines in the group are
+// active.
+func (g *Group) SetLimit(n int) {
+	if n < 0 {
+		g.sem = nil
+		return
+	}
+	if len(g.sem) != 0 {
+		panic(fmt.Errorf("group: modify limit while %v goroutines in the group are still active", len(g.sem)))
+	}
+
+	g.sem = make(chan struct{}, n)
+}
+
+// Go calls the given function in a new goroutine. It blocks until the
+// new goroutine can be added without the number of active goroutines in
+// the group exceeding the configured limit.
+//
+// Panics raised by fn are recovered and treated as a *PanicError.
+func (g *Group) Go(fn func() error) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+
+	g.wg.Add(1)
+
+	go g.run(fn)
+}
+
+// TryGo calls the given function in a new goroutine only if the number
+// of active goroutines in the group is currently below the configured
+// limit.
+//
+// The return value reports whether the goroutine was started.
+func (g *Group) TryGo(fn func() error) bool {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		default:
+			return false
+		}
+	}
+
+	g.wg.Add(1)
+
+	go g.run(fn)
+
+	return true
+}
+
+// Wait blocks until all function calls from the Go method have returned,
+// then returns the first error from them, or all of them combined when
+// the collect-all mode is enabled.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+
+	if g.collectAll {
+		g.err = g.CollectAsError()
+	}
+	if g.cancel != nil {
+		g.cancel(g.err)
+	}
+
+	return g.err
+}
+
+func (g *Group) run(fn func() error) {
+	defer g.done()
+
+	err := callWithPanicRecovery(fn)
+	if err == nil {
+		return
+	}
+
+	if g.collectAll {
+		g.handleError(err)
+	}
+
+	g.errOnce.Do(func() {
+		g.err = err
+		if g.cancel != nil {
+			g.cancel(err)
+		}
+	})
+}
+
+func (g *Group) done() {
+	if g.sem != nil {
+		<-g.sem
+	}
+
+	g.wg.Done()
+}
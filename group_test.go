@@ -0,0 +1,215 @@
+package fo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup(t *testing.T) {
+	t.Parallel()
+
+	t.Run("NoError", func(t *testing.T) {
+		t.Parallel()
+
+		var count atomic.Int32
+
+		g := NewGroup()
+		for i := 0; i < 10; i++ {
+			g.Go(func() error {
+				count.Add(1)
+				return nil
+			})
+		}
+
+		require.NoError(t, g.Wait())
+		assert.Equal(t, int32(10), count.Load())
+	})
+
+	t.Run("FirstError", func(t *testing.T) {
+		t.Parallel()
+
+		err1 := errors.New("error 1")
+
+		g := NewGroup()
+		g.Go(func() error {
+			return err1
+		})
+		g.Go(func() error {
+			time.Sleep(50 * time.Millisecond)
+			return errors.New("error 2")
+		})
+
+		err := g.Wait()
+		require.Error(t, err)
+		assert.Equal(t, err1, err)
+		assert.Empty(t, g.CollectAsErrors())
+	})
+
+	t.Run("CollectAll", func(t *testing.T) {
+		t.Parallel()
+
+		var handled atomic.Int32
+
+		g := NewGroup().CollectAll().Use(func(err error, messageArgs ...any) {
+			handled.Add(1)
+		})
+
+		for i := 0; i < 3; i++ {
+			g.Go(func() error {
+				return fmt.Errorf("error %d", i)
+			})
+		}
+		g.Go(func() error {
+			return nil
+		})
+
+		err := g.Wait()
+		require.Error(t, err)
+		assert.Equal(t, int32(3), handled.Load())
+		assert.Len(t, g.CollectAsErrors(), 3)
+
+		for i := 0; i < 3; i++ {
+			assert.ErrorContains(t, err, fmt.Sprintf("error %d", i))
+		}
+
+		var handledErrs []error
+
+		g.HandleErrors(func(errs []error) {
+			handledErrs = errs
+		})
+		assert.Len(t, handledErrs, 3)
+	})
+
+	t.Run("PanicRecovery", func(t *testing.T) {
+		t.Parallel()
+
+		g := NewGroup()
+		g.Go(func() error {
+			panic("something went wrong")
+		})
+
+		err := g.Wait()
+		require.Error(t, err)
+
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+		assert.Equal(t, "something went wrong", panicErr.Value)
+		assert.NotEmpty(t, panicErr.Stack)
+		assert.EqualError(t, err, "panic: something went wrong")
+	})
+
+	t.Run("CancelOnFirstError", func(t *testing.T) {
+		t.Parallel()
+
+		g, ctx := NewGroupWithContext(context.Background())
+		g.Go(func() error {
+			return assert.AnError
+		})
+		g.Go(func() error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+				return nil
+			}
+		})
+
+		start := time.Now()
+		err := g.Wait()
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+		assert.ErrorIs(t, context.Cause(ctx), assert.AnError)
+	})
+
+	t.Run("CancelOnWait", func(t *testing.T) {
+		t.Parallel()
+
+		g, ctx := NewGroupWithContext(context.Background())
+		g.Go(func() error {
+			return nil
+		})
+
+		require.NoError(t, g.Wait())
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	})
+
+	t.Run("SetLimit", func(t *testing.T) {
+		t.Parallel()
+
+		var active atomic.Int32
+		var maxActive atomic.Int32
+
+		g := NewGroup()
+		g.SetLimit(2)
+
+		for i := 0; i < 10; i++ {
+			g.Go(func() error {
+				n := active.Add(1)
+				defer active.Add(-1)
+
+				for {
+					current := maxActive.Load()
+					if n <= current || maxActive.CompareAndSwap(current, n) {
+						break
+					}
+				}
+
+				time.Sleep(10 * time.Millisecond)
+
+				return nil
+			})
+		}
+
+		require.NoError(t, g.Wait())
+		assert.LessOrEqual(t, maxActive.Load(), int32(2))
+	})
+
+	t.Run("TryGo", func(t *testing.T) {
+		t.Parallel()
+
+		release := make(chan struct{})
+
+		g := NewGroup()
+		g.SetLimit(1)
+
+		assert.True(t, g.TryGo(func() error {
+			<-release
+			return nil
+		}))
+		assert.False(t, g.TryGo(func() error {
+			return nil
+		}))
+
+		close(release)
+		require.NoError(t, g.Wait())
+
+		assert.True(t, g.TryGo(func() error {
+			return nil
+		}))
+		require.NoError(t, g.Wait())
+	})
+}
+
+func ExampleGroup_CollectAll() {
+	g := NewGroup().CollectAll()
+
+	g.Go(func() error {
+		return errors.New("error 1")
+	})
+	g.Go(func() error {
+		return nil
+	})
+
+	err := g.Wait()
+
+	fmt.Println(err, len(g.CollectAsErrors()))
+	// Output: error 1 1
+}
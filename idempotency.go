@@ -0,0 +1,418 @@
+package fo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// IdempotencyStore is the storage backend of the results of the
+// invocations made with WithIdempotencyKey(...). Implementations must be
+// safe for concurrent use.
+type IdempotencyStore interface {
+	// Load returns the JSON-encoded results stored with the key, and
+	// false if there are no results or the results are expired.
+	Load(key string) (json.RawMessage, bool, error)
+	// Store stores the JSON-encoded results with the key.
+	Store(key string, results json.RawMessage) error
+}
+
+var (
+	_ IdempotencyStore = (*MemoryIdempotencyStore)(nil)
+	_ IdempotencyStore = (*FileIdempotencyStore)(nil)
+)
+
+// idempotencyRecord is the results stored with the key.
+type idempotencyRecord struct {
+	Key       string          `json:"key"`
+	Results   json.RawMessage `json:"results"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// expired reports whether the record is expired at now, the records
+// without the expiration time never expire.
+func (r idempotencyRecord) expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+// newIdempotencyRecord creates a new record that expires after the
+// retention, a non-positive retention indicates no expiration.
+func newIdempotencyRecord(key string, results json.RawMessage, retention time.Duration) idempotencyRecord {
+	record := idempotencyRecord{
+		Key:     key,
+		Results: results,
+	}
+	if retention > 0 {
+		record.ExpiresAt = time.Now().Add(retention)
+	}
+
+	return record
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore that keeps the results in
+// memory for the retention window.
+type MemoryIdempotencyStore struct {
+	retention time.Duration
+
+	mutex   sync.Mutex
+	records map[string]idempotencyRecord
+}
+
+// NewMemoryIdempotencyStore creates a new MemoryIdempotencyStore that keeps
+// the results for the retention window, a non-positive retention keeps
+// them forever.
+func NewMemoryIdempotencyStore(retention time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		retention: retention,
+		records:   make(map[string]idempotencyRecord),
+	}
+}
+
+// Load implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Load(key string) (json.RawMessage, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, ok := s.records[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if record.expired(time.Now()) {
+		delete(s.records, key)
+		return nil, false, nil
+	}
+
+	return record.Results, true, nil
+}
+
+// Store implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Store(key string, results json.RawMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.records[key] = newIdempotencyRecord(key, results, s.retention)
+
+	return nil
+}
+
+// FileIdempotencyStore is an IdempotencyStore that keeps the results in
+// memory, and appends them to a local file as JSON lines so that they
+// survive restarts. The expired results are dropped from the file when
+// it is opened.
+type FileIdempotencyStore struct {
+	*MemoryIdempotencyStore
+
+	fileMutex sync.Mutex
+	file      *os.File
+}
+
+// NewFileIdempotencyStore opens or creates the file at path, and loads
+// the results that are not expired yet. The file should be closed with
+// Close().
+func NewFileIdempotencyStore(path string, retention time.Duration) (*FileIdempotencyStore, error) {
+	memory := NewMemoryIdempotencyStore(retention)
+
+	err := loadIdempotencyRecords(path, memory)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("idempotency: failed to open file: %w", err)
+	}
+
+	return &FileIdempotencyStore{
+		MemoryIdempotencyStore: memory,
+		file:                   file,
+	}, nil
+}
+
+// Store implements IdempotencyStore.
+func (s *FileIdempotencyStore) Store(key string, results json.RawMessage) error {
+	record := newIdempotencyRecord(key, results, s.retention)
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("idempotency: failed to encode results: %w", err)
+	}
+
+	s.fileMutex.Lock()
+	defer s.fileMutex.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("idempotency: %w", os.ErrClosed)
+	}
+
+	_, err = s.file.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("idempotency: failed to write results: %w", err)
+	}
+
+	err = s.file.Sync()
+	if err != nil {
+		return fmt.Errorf("idempotency: failed to sync file: %w", err)
+	}
+
+	s.mutex.Lock()
+	s.records[key] = record
+	s.mutex.Unlock()
+
+	return nil
+}
+
+// Close closes the file.
+func (s *FileIdempotencyStore) Close() error {
+	s.fileMutex.Lock()
+	defer s.fileMutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+// loadIdempotencyRecords loads the records that are not expired from the
+// file at path into memory, and rewrites the file without the expired and
+// the torn ones.
+func loadIdempotencyRecords(path string, memory *MemoryIdempotencyStore) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("idempotency: failed to read file: %w", err)
+	}
+
+	now := time.Now()
+	dropped := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(data)+1)
+
+	for scanner.Scan() {
+		var record idempotencyRecord
+
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil || record.expired(now) {
+			dropped++
+			continue
+		}
+
+		memory.records[record.Key] = record
+	}
+	if dropped == 0 {
+		return nil
+	}
+
+	var buffer bytes.Buffer
+
+	encoder := json.NewEncoder(&buffer)
+	for _, record := range memory.records {
+		err = encoder.Encode(record)
+		if err != nil {
+			return fmt.Errorf("idempotency: failed to encode results: %w", err)
+		}
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+
+	err = os.WriteFile(tmp, buffer.Bytes(), 0o600)
+	if err != nil {
+		return fmt.Errorf("idempotency: failed to compact file: %w", err)
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return fmt.Errorf("idempotency: failed to compact file: %w", err)
+	}
+
+	return nil
+}
+
+// idempotentCall is an in-flight invocation with the idempotency key.
+type idempotentCall struct {
+	done    chan struct{}
+	results json.RawMessage
+	err     error
+}
+
+var (
+	idempotentCallsMutex sync.Mutex
+	idempotentCalls      = make(map[string]*idempotentCall)
+)
+
+// acquireIdempotentCall returns the in-flight invocation with the key, and
+// whether the caller starts it and should release it afterwards.
+func acquireIdempotentCall(key string) (*idempotentCall, bool) {
+	idempotentCallsMutex.Lock()
+	defer idempotentCallsMutex.Unlock()
+
+	call, ok := idempotentCalls[key]
+	if ok {
+		return call, false
+	}
+
+	call = &idempotentCall{
+		done: make(chan struct{}),
+		err:  fmt.Errorf("idempotency: in-flight call with key '%s' panicked", key),
+	}
+	idempotentCalls[key] = call
+
+	return call, true
+}
+
+func releaseIdempotentCall(key string, call *idempotentCall) {
+	idempotentCallsMutex.Lock()
+	delete(idempotentCalls, key)
+	idempotentCallsMutex.Unlock()
+
+	close(call.done)
+}
+
+// WithIdempotencyKey makes the invocation idempotent with the key. If an
+// invocation with the same key succeeded within the retention window of
+// the store, its results are returned without calling the callback
+// function again. The concurrent invocations with the same key wait for
+// the in-flight one and share its results or error, except for the
+// timeout or cancellation of its caller, in which case they take over.
+// The key stays in flight until the callback function returns, even if
+// it is abandoned by the timeout, and its results are stored once it
+// succeeds. Results must be encodable with encoding/json, errors are not
+// stored.
+//
+// The keys are shared by all the stores, so that they should be unique
+// across the call sites, e.g. prefixed with the name of the operation.
+func WithIdempotencyKey(key string, store IdempotencyStore) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeIdempotencyKey,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				idempotencyKey:      key,
+				idempotencyStore:    store,
+				idempotencyKeyIsSet: true,
+			}
+		},
+	}
+}
+
+// idempotent serves the invocation from the store if it succeeded before,
+// waits for the in-flight one with the same key, or invokes fn with invoke
+// and stores its results. The key is held until the callback function
+// exits, even if it is abandoned by the timeout, so that the side effects
+// never run in parallel. The waiters take over instead of sharing the
+// error if the in-flight invocation failed due to its own context.
+func idempotent[R any](ctx context.Context, store IdempotencyStore, key string, decoder resultsDecoder, fn func(ctx context.Context) (R, error), invoke func(fn func(ctx context.Context) (R, error)) (R, error)) (R, error) {
+	var res R
+
+	for {
+		call, leader := acquireIdempotentCall(key)
+		if leader {
+			return leadIdempotentCall(ctx, store, key, decoder, call, fn, invoke)
+		}
+
+		select {
+		case <-ctx.Done():
+			return res, contextError(ctx)
+		case <-call.done:
+		}
+
+		if call.err == nil {
+			return decodeIdempotentResults[R](key, call.results, decoder)
+		}
+		if !errors.Is(call.err, context.DeadlineExceeded) && !errors.Is(call.err, context.Canceled) {
+			return res, call.err
+		}
+	}
+}
+
+// leadIdempotentCall invokes the in-flight invocation with the key. The
+// results of the callback function succeeded after the invocation gave up
+// are stored as well, so that the retries don't run it again.
+func leadIdempotentCall[R any](ctx context.Context, store IdempotencyStore, key string, decoder resultsDecoder, call *idempotentCall, fn func(ctx context.Context) (R, error), invoke func(fn func(ctx context.Context) (R, error)) (R, error)) (R, error) {
+	var res R
+	var succeeded R
+	var hasSucceeded bool
+
+	turn := &keyedTurn{release: func() {
+		if call.err != nil && hasSucceeded {
+			results, err := json.Marshal(succeeded)
+			if err == nil && store.Store(key, results) == nil {
+				call.results, call.err = results, nil
+			}
+		}
+
+		releaseIdempotentCall(key, call)
+	}}
+	defer turn.done()
+
+	results, ok, err := store.Load(key)
+	if err != nil {
+		call.err = fmt.Errorf("idempotency: failed to load results of '%s': %w", key, err)
+		return res, call.err
+	}
+	if ok {
+		call.results, call.err = results, nil
+		return decodeIdempotentResults[R](key, results, decoder)
+	}
+
+	res, err = invoke(func(ctx context.Context) (R, error) {
+		var empty R
+
+		err := turn.enter(ctx)
+		if err != nil {
+			return empty, err
+		}
+
+		defer turn.exit()
+
+		if hasSucceeded {
+			return succeeded, nil
+		}
+
+		res, err := fn(ctx)
+		if err == nil {
+			succeeded, hasSucceeded = res, true
+		}
+
+		return res, err
+	})
+	if err != nil {
+		call.err = err
+		return res, err
+	}
+
+	results, err = json.Marshal(res)
+	if err != nil {
+		call.err = fmt.Errorf("idempotency: failed to encode results of '%s': %w", key, err)
+		return res, call.err
+	}
+
+	call.results, call.err = results, nil
+
+	err = store.Store(key, results)
+	if err != nil {
+		return res, fmt.Errorf("idempotency: failed to store results of '%s': %w", key, err)
+	}
+
+	return res, nil
+}
+
+func decodeIdempotentResults[R any](key string, results json.RawMessage, decoder resultsDecoder) (R, error) {
+	res, err := decodeResults[R](results, decoder)
+	if err != nil {
+		return res, fmt.Errorf("idempotency: failed to decode results of '%s': %w", key, err)
+	}
+
+	return res, nil
+}
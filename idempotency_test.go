@@ -0,0 +1,304 @@
+package fo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Stored", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewMemoryIdempotencyStore(time.Minute)
+
+		var calls atomic.Int32
+
+		charge := func(amount int) func() (string, int, error) {
+			return func() (string, int, error) {
+				calls.Add(1)
+				return "charge-1", amount, nil
+			}
+		}
+
+		id, amount, err := InvokeWith2(charge(100), WithIdempotencyKey("test.stored.order-1", store))
+		require.NoError(t, err)
+		assert.Equal(t, "charge-1", id)
+		assert.Equal(t, 100, amount)
+
+		id, amount, err = InvokeWith2(charge(200), WithIdempotencyKey("test.stored.order-1", store))
+		require.NoError(t, err)
+		assert.Equal(t, "charge-1", id)
+		assert.Equal(t, 100, amount)
+		assert.Equal(t, int32(1), calls.Load())
+
+		_, amount, err = InvokeWith2(charge(300), WithIdempotencyKey("test.stored.order-2", store))
+		require.NoError(t, err)
+		assert.Equal(t, 300, amount)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewMemoryIdempotencyStore(time.Minute)
+
+		var calls atomic.Int32
+
+		call := func() (int, error) {
+			if calls.Add(1) == 1 {
+				return 0, assert.AnError
+			}
+
+			return 42, nil
+		}
+
+		_, err := InvokeWith(call, WithIdempotencyKey("test.error", store))
+		require.ErrorIs(t, err, assert.AnError)
+
+		res, err := InvokeWith(call, WithIdempotencyKey("test.error", store))
+		require.NoError(t, err)
+		assert.Equal(t, 42, res)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewMemoryIdempotencyStore(10 * time.Millisecond)
+
+		var calls atomic.Int32
+
+		call := func() (int, error) {
+			return int(calls.Add(1)), nil
+		}
+
+		res, err := InvokeWith(call, WithIdempotencyKey("test.expired", store))
+		require.NoError(t, err)
+		assert.Equal(t, 1, res)
+
+		time.Sleep(20 * time.Millisecond)
+
+		res, err = InvokeWith(call, WithIdempotencyKey("test.expired", store))
+		require.NoError(t, err)
+		assert.Equal(t, 2, res)
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewMemoryIdempotencyStore(time.Minute)
+
+		var calls atomic.Int32
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		call := func() (int, error) {
+			calls.Add(1)
+			close(started)
+			<-release
+
+			return 42, nil
+		}
+
+		var wg sync.WaitGroup
+
+		results := make([]int, 5)
+		errs := make([]error, 5)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			results[0], errs[0] = InvokeWith(call, WithIdempotencyKey("test.concurrent", store))
+		}()
+
+		<-started
+
+		for i := 1; i < 5; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				results[i], errs[i] = InvokeWith(call, WithIdempotencyKey("test.concurrent", store))
+			}()
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, int32(1), calls.Load())
+		assert.Equal(t, []int{42, 42, 42, 42, 42}, results)
+		assert.Equal(t, make([]error, 5), errs)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewMemoryIdempotencyStore(time.Minute)
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		go func() {
+			_ = InvokeWithContext0(context.Background(), func(context.Context) error {
+				close(started)
+				<-release
+
+				return nil
+			}, WithIdempotencyKey("test.canceled", store))
+		}()
+
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := InvokeWithContext0(ctx, func(context.Context) error {
+			return nil
+		}, WithIdempotencyKey("test.canceled", store))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		close(release)
+	})
+
+	t.Run("Timed out", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewMemoryIdempotencyStore(time.Minute)
+
+		var calls, running, maxRunning atomic.Int32
+
+		call := func(context.Context) (int, error) {
+			calls.Add(1)
+
+			current := running.Add(1)
+			defer running.Add(-1)
+
+			for {
+				peak := maxRunning.Load()
+				if current <= peak || maxRunning.CompareAndSwap(peak, current) {
+					break
+				}
+			}
+
+			// ignores the context, and succeeds after the caller gave up
+			time.Sleep(50 * time.Millisecond)
+
+			return 42, nil
+		}
+
+		leaderErr := make(chan error, 1)
+
+		go func() {
+			_, err := InvokeWithContext(context.Background(), call, WithIdempotencyKey("test.timed_out", store), WithContextTimeout(10*time.Millisecond))
+			leaderErr <- err
+		}()
+
+		require.Eventually(t, func() bool {
+			return calls.Load() == 1
+		}, time.Second, time.Millisecond)
+
+		// waits for the abandoned call instead of running in parallel, and
+		// shares its results instead of the timeout of the leader
+		res, err := InvokeWithContext(context.Background(), call, WithIdempotencyKey("test.timed_out", store), WithContextTimeout(time.Second))
+		require.NoError(t, err)
+		assert.Equal(t, 42, res)
+		assert.Equal(t, int32(1), calls.Load())
+		assert.Equal(t, int32(1), maxRunning.Load())
+		require.ErrorIs(t, <-leaderErr, context.DeadlineExceeded)
+	})
+
+	t.Run("File", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "idempotency.jsonl")
+
+		store, err := NewFileIdempotencyStore(path, time.Minute)
+		require.NoError(t, err)
+
+		var calls atomic.Int32
+
+		call := func() (string, error) {
+			calls.Add(1)
+			return "ok", nil
+		}
+
+		_, err = InvokeWith(call, WithIdempotencyKey("test.file", store))
+		require.NoError(t, err)
+		require.NoError(t, store.Close())
+
+		store, err = NewFileIdempotencyStore(path, time.Minute)
+		require.NoError(t, err)
+
+		defer store.Close()
+
+		res, err := InvokeWith(call, WithIdempotencyKey("test.file", store))
+		require.NoError(t, err)
+		assert.Equal(t, "ok", res)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("Unset", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+
+		for range 2 {
+			err := InvokeWith0(func() error {
+				calls.Add(1)
+				return nil
+			}, WithIdempotencyKey("", NewMemoryIdempotencyStore(0)))
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, int32(2), calls.Load())
+	})
+}
+
+func TestFileIdempotencyStore(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "idempotency.jsonl")
+
+	// an expired record, a torn line and a record that never expires
+	err := os.WriteFile(path, []byte(strings.Join([]string{
+		`{"key":"expired","results":1,"expires_at":"2020-01-01T00:00:00Z"}`,
+		`{"key":"torn","resu`,
+		`{"key":"kept","results":2,"expires_at":"0001-01-01T00:00:00Z"}`,
+	}, "\n")), 0o600)
+	require.NoError(t, err)
+
+	store, err := NewFileIdempotencyStore(path, 0)
+	require.NoError(t, err)
+
+	defer store.Close()
+
+	_, ok, err := store.Load("expired")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	results, ok, err := store.Load("kept")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.JSONEq(t, "2", string(results))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "\n"))
+	assert.Contains(t, string(data), `"key":"kept"`)
+}
@@ -0,0 +1,87 @@
+package fo
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ErrIdleTimeout is returned by the invocations with WithIdleTimeout(...)
+// when no heartbeat arrives within the idle window. It wraps
+// context.DeadlineExceeded, so that it is treated as a timeout.
+var ErrIdleTimeout = fmt.Errorf("fo: idle timeout exceeded: %w", context.DeadlineExceeded)
+
+type idleTimerKey struct{}
+
+// idleTimer cancels the context once it is not reset within the idle
+// window.
+type idleTimer struct {
+	idle  time.Duration
+	timer *time.Timer
+}
+
+// WithIdleTimeout sets the idle timeout of the invocation, the context of
+// the callback function is canceled only if no heartbeat arrives within
+// the idle window, instead of after a fixed duration. It is meant for
+// streaming works like long downloads, which should fail when they stall
+// rather than when they are merely slow.
+//
+// The callback function of the context-aware variants InvokeWithContext*
+// sends the heartbeats with Heartbeat(ctx), the idle window starts over
+// on every heartbeat. The invocation returns ErrIdleTimeout once the idle
+// timeout fires, while context.Cause(ctx) of the callback function
+// returns ErrIdleTimeout.
+//
+// The idle timeout can be combined with WithContextTimeout(...), which
+// caps the total duration of the invocation no matter how many
+// heartbeats arrive:
+//
+//	n, err := fo.InvokeWithContext(ctx, func(ctx context.Context) (int64, error) {
+//		return download(ctx, url, func() { fo.Heartbeat(ctx) })
+//	}, fo.WithIdleTimeout(10*time.Second), fo.WithContextTimeout(time.Hour))
+//
+// A non-positive idle disables the idle timeout.
+func WithIdleTimeout(idle time.Duration) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeIdleTimeout,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				idleTimeout:      idle,
+				idleTimeoutIsSet: true,
+			}
+		},
+	}
+}
+
+// Heartbeat extends the idle timeout of the invocation that ctx belongs
+// to by another idle window, it has no effect if the invocation has no
+// idle timeout set by WithIdleTimeout(...) or the idle timeout has
+// already fired.
+func Heartbeat(ctx context.Context) {
+	timer, ok := ctx.Value(idleTimerKey{}).(*idleTimer)
+	if !ok {
+		return
+	}
+
+	timer.timer.Reset(timer.idle)
+}
+
+// withIdleTimeout returns a copy of ctx which is canceled with
+// ErrIdleTimeout as the cause if Heartbeat(...) is not called with it
+// within the idle window. The returned function releases the resources
+// and should be called once the invocation returns.
+func withIdleTimeout(ctx context.Context, idle time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	timer := &idleTimer{
+		idle: idle,
+		timer: time.AfterFunc(idle, func() {
+			cancel(ErrIdleTimeout)
+		}),
+	}
+
+	return context.WithValue(ctx, idleTimerKey{}, timer), func() {
+		timer.timer.Stop()
+		cancel(context.Canceled)
+	}
+}
@@ -0,0 +1,92 @@
+package fo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithIdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Heartbeats", func(t *testing.T) {
+		t.Parallel()
+
+		start := time.Now()
+
+		res, err := InvokeWithContext(context.Background(), func(ctx context.Context) (int, error) {
+			chunks := 0
+
+			for range 10 {
+				time.Sleep(10 * time.Millisecond)
+				Heartbeat(ctx)
+
+				chunks++
+			}
+
+			return chunks, ctx.Err()
+		}, WithIdleTimeout(50*time.Millisecond))
+		require.NoError(t, err)
+		assert.Equal(t, 10, res)
+		assert.Greater(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("Stalled", func(t *testing.T) {
+		t.Parallel()
+
+		cause := make(chan error, 1)
+
+		_, err := InvokeWithContext(context.Background(), func(ctx context.Context) (int, error) {
+			Heartbeat(ctx)
+
+			<-ctx.Done()
+			cause <- context.Cause(ctx)
+
+			return 0, ctx.Err()
+		}, WithIdleTimeout(20*time.Millisecond))
+		require.ErrorIs(t, err, ErrIdleTimeout)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		select {
+		case err := <-cause:
+			assert.ErrorIs(t, err, ErrIdleTimeout)
+		case <-time.After(time.Second):
+			assert.Fail(t, "callback context is not done")
+		}
+	})
+
+	t.Run("Max duration", func(t *testing.T) {
+		t.Parallel()
+
+		start := time.Now()
+
+		err := InvokeWithContext0(context.Background(), func(ctx context.Context) error {
+			for ctx.Err() == nil {
+				time.Sleep(5 * time.Millisecond)
+				Heartbeat(ctx)
+			}
+
+			return ctx.Err()
+		}, WithIdleTimeout(20*time.Millisecond), WithContextTimeout(60*time.Millisecond))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.NotErrorIs(t, err, ErrIdleTimeout)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+
+	t.Run("Without idle timeout", func(t *testing.T) {
+		t.Parallel()
+
+		assert.NotPanics(t, func() {
+			Heartbeat(context.Background())
+		})
+
+		err := InvokeWithContext0(context.Background(), func(ctx context.Context) error {
+			Heartbeat(ctx)
+			return nil
+		}, WithIdleTimeout(0))
+		require.NoError(t, err)
+	})
+}
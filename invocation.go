@@ -0,0 +1,115 @@
+package fo
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	packageFuncPrefix = "github.com/nekomeowww/fo."
+)
+
+// invocation describes a single invocation of a callback function.
+type invocation struct {
+	name      string
+	caller    string
+	labels    []string
+	profiling bool
+	observers []Observer
+	attempt   int
+
+	captureTimeoutStack bool
+	watchdogInterval    time.Duration
+	watchdogHandler     WatchdogHandler
+	idleTimeout         time.Duration
+	tracker             *Tracker
+	scheduler           *Scheduler
+	tenant              string
+	minRemaining        time.Duration
+	expectedDuration    time.Duration
+	sheddingHistogram   *LatencyHistogram
+	sheddingQuantile    float64
+	adaptiveTimeout     *adaptiveTimeout
+}
+
+// newInvocation creates a new invocation from the options with the call
+// site resolved from the current stack if it is needed.
+func newInvocation(options *invokeWithOptions) *invocation {
+	observers := currentObservers()
+	if len(options.observers) > 0 {
+		observers = append(append(make([]Observer, 0, len(observers)+len(options.observers)), observers...), options.observers...)
+	}
+
+	tracker := options.tracker
+	if !options.trackerIsSet {
+		tracker = currentTracker()
+	}
+
+	call := &invocation{
+		name:      options.name,
+		labels:    options.labels,
+		profiling: len(options.labels) > 0 || profilingLabels.Load(),
+		observers: observers,
+		attempt:   1,
+
+		captureTimeoutStack: options.captureTimeoutStack,
+		watchdogInterval:    options.watchdogInterval,
+		watchdogHandler:     options.watchdogHandler,
+		idleTimeout:         options.idleTimeout,
+		tracker:             tracker,
+		scheduler:           options.scheduler,
+		tenant:              options.tenant,
+		minRemaining:        options.minRemaining,
+		expectedDuration:    options.expectedDuration,
+		sheddingHistogram:   options.sheddingHistogram,
+		sheddingQuantile:    options.sheddingQuantile,
+		adaptiveTimeout:     options.adaptiveTimeout,
+	}
+	if call.needsCallSite() {
+		call.caller = callSite()
+	}
+
+	return call
+}
+
+// needsCallSite reports whether the call site is reported by any of the
+// pprof labels, observers, spans, watchdog, tracker and debug tracking,
+// resolving it walks the stack, so that it is skipped otherwise.
+func (c *invocation) needsCallSite() bool {
+	return c.profiling ||
+		len(c.observers) > 0 ||
+		c.watchdogInterval > 0 ||
+		c.tracker != nil ||
+		debugTracking.Load() ||
+		currentSpanExporter() != nil
+}
+
+// withAttempt returns a copy of the invocation for the attempt.
+func (c *invocation) withAttempt(attempt int) *invocation {
+	copied := *c
+	copied.attempt = attempt
+
+	return &copied
+}
+
+// callSite returns the first caller outside of package fo, formatted as
+// "<function>:<line>". Frames in the test files of package fo are
+// treated as outside callers.
+func callSite() string {
+	var pcs [32]uintptr
+
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, packageFuncPrefix) || strings.HasSuffix(frame.File, "_test.go") {
+			return frame.Function + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package fo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInvocation(t *testing.T) {
+	t.Parallel()
+
+	observer := ObserverFuncs{}
+
+	call := newInvocation(&invokeWithOptions{name: "foo", labels: []string{"k", "v"}, observers: []Observer{observer}})
+	assert.Equal(t, "foo", call.name)
+	assert.Contains(t, call.caller, "fo.TestNewInvocation:")
+	assert.Equal(t, []string{"k", "v"}, call.labels)
+	assert.Contains(t, call.observers, Observer(observer))
+	assert.Equal(t, 1, call.attempt)
+
+	retried := call.withAttempt(2)
+	assert.Equal(t, 2, retried.attempt)
+	assert.Equal(t, 1, call.attempt)
+}
@@ -2,30 +2,217 @@ package fo
 
 import (
 	"context"
+	"errors"
+	"runtime/pprof"
+	"runtime/trace"
+	"sync/atomic"
+	"time"
 )
 
-func invoke[R any](ctx context.Context, fn func() (R, error)) (r R, e error) {
+const (
+	invocationStateRunning int32 = iota
+	invocationStateFinished
+	invocationStateAbandoned
+)
+
+var (
+	inFlightInvocations  atomic.Int64
+	abandonedInvocations atomic.Int64
+)
+
+// InFlightInvocations returns the number of the callback goroutines that
+// are still running, including the abandoned ones.
+func InFlightInvocations() int64 {
+	return inFlightInvocations.Load()
+}
+
+// AbandonedInvocations returns the number of the callback goroutines
+// that are still running after their callers have left due to the
+// context is done.
+func AbandonedInvocations() int64 {
+	return abandonedInvocations.Load()
+}
+
+// invoke calls fn in a new goroutine and waits for either fn returns or
+// ctx is done.
+func invoke[R any](ctx context.Context, fn func() (R, error)) (R, error) {
+	return invokeCall(ctx, newInvocation(&invokeWithOptions{}), func(context.Context) (R, error) {
+		return fn()
+	})
+}
+
+// invokeCall calls the context-aware fn in a new goroutine labeled with
+// the pprof labels of call if enabled, and waits for either fn returns or ctx is
+// done. A runtime/trace task and region will be created for the
+// invocation if tracing is enabled, a span will be exported if a
+// SpanExporter is set, and the observers of call will be notified with
+// the events of the invocation.
+//
+// If fn panics while the caller is still waiting, the panic will be
+// recovered and re-panicked as *PanicError in the caller's goroutine so
+// that it can be recovered by the caller. If the caller has already left
+// due to ctx is done, the panic will be re-panicked in the callback
+// goroutine as it used to be.
+func invokeCall[R any](ctx context.Context, call *invocation, fn func(ctx context.Context) (R, error)) (r R, e error) {
 	var res R
 	var err error
+	var panicErr *PanicError
+	var state atomic.Int32
+
+	ctx, tracked, err := call.tracker.admit(ctx)
+	if err != nil {
+		return res, err
+	}
+
+	if trace.IsEnabled() {
+		var task *trace.Task
+		ctx, task = trace.NewTask(ctx, call.traceName())
 
-	resChan := make(chan struct{})
+		defer task.End()
+	}
+
+	ctx, span := startInvocationSpan(ctx, call)
+
+	start := time.Now()
+	call.notify(invocationEventKindStart, start, nil)
+
+	resChan := make(chan struct{}, 1)
+
+	running, untrack := trackInvocation(ctx, call, start, tracked != nil)
+	if tracked != nil {
+		tracked.running.Store(running)
+	}
+
+	stopWatchdog := startWatchdog(ctx, call, running)
+
+	inFlightInvocations.Add(1)
 
 	go func() {
-		res, err = fn()
-		resChan <- struct{}{}
+		if running != nil {
+			running.goroutineID.Store(currentGoroutineID())
+		}
+
+		defer func() {
+			v := recover()
+
+			stopWatchdog()
+			untrack()
+			call.tracker.release(tracked)
+
+			finished := state.CompareAndSwap(invocationStateRunning, invocationStateFinished)
+			if !finished {
+				abandonedInvocations.Add(-1)
+			}
+
+			inFlightInvocations.Add(-1)
+
+			if v != nil {
+				panicErr = newPanicError(v)
+				if !finished {
+					call.notify(invocationEventKindPanic, start, panicErr)
+					panic(panicErr)
+				}
+			}
+
+			resChan <- struct{}{}
+		}()
+
+		run := func(ctx context.Context) {
+			trace.WithRegion(ctx, call.traceName(), func() {
+				res, err = fn(ctx)
+				err = callbackError(ctx, err)
+			})
+		}
+
+		if call.profiling {
+			pprof.Do(ctx, call.pprofLabels(), run)
+		} else {
+			run(ctx)
+		}
 	}()
 
 	select {
 	case <-ctx.Done():
-		e = ctx.Err()
+		abandonedInvocations.Add(1)
+
+		if state.CompareAndSwap(invocationStateRunning, invocationStateAbandoned) {
+			if running != nil {
+				running.abandoned.Store(true)
+			}
+
+			e = contextError(ctx)
+			if call.captureTimeoutStack {
+				e = newTimeoutError(e, running.goroutineID.Load())
+			}
+
+			call.notify(invocationEventKindTimeout, start, e)
+			span.end(OutcomeTimeout, e)
+
+			return
+		}
+
+		abandonedInvocations.Add(-1)
+		<-resChan
 	case <-resChan:
-		r = res
-		e = err
 	}
 
+	if panicErr != nil {
+		call.notify(invocationEventKindPanic, start, panicErr)
+		span.end(OutcomePanic, panicErr)
+		panic(panicErr)
+	}
+
+	call.notify(invocationEventKindFinish, start, err)
+
+	if err != nil {
+		span.end(OutcomeError, err)
+	} else {
+		span.end(OutcomeOK, nil)
+	}
+
+	r = res
+	e = err
+
 	return
 }
 
+// cancelCause returns the cause of the canceled ctx if it is canceled by
+// the idle timeout or Tracker.Shutdown(...), or nil otherwise.
+func cancelCause(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	if errors.Is(cause, ErrIdleTimeout) || errors.Is(cause, ErrShuttingDown) {
+		return cause
+	}
+
+	return nil
+}
+
+// contextError returns the error of the done ctx, which is
+// ErrIdleTimeout if ctx is canceled by the idle timeout, or
+// ErrShuttingDown if ctx is canceled by Tracker.Shutdown(...).
+func contextError(ctx context.Context) error {
+	if cause := cancelCause(ctx); cause != nil {
+		return cause
+	}
+
+	return ctx.Err()
+}
+
+// callbackError replaces context.Canceled returned by the callback
+// function with the cause of ctx if it is canceled by the idle timeout or
+// Tracker.Shutdown(...), so that the callback functions returning
+// ctx.Err() are reported the same as the abandoned ones.
+func callbackError(ctx context.Context, err error) error {
+	if !errors.Is(err, context.Canceled) {
+		return err
+	}
+	if cause := cancelCause(ctx); cause != nil {
+		return cause
+	}
+
+	return err
+}
+
 // Invoke0 has the same behavior as Invoke but without return value.
 func Invoke0(ctx context.Context, fn func() error) error {
 	_, err := invoke(ctx, func() (any, error) {
@@ -37,6 +224,11 @@ func Invoke0(ctx context.Context, fn func() error) error {
 
 // Invoke invokes the callback function and enables to control the
 // context of the callback function with 1 return value.
+//
+// If the callback function panics while the caller is still waiting, the
+// panic is re-panicked as *PanicError in the caller's goroutine, so that
+// it can be recovered by the caller. The panics raised after the caller
+// has left due to ctx is done crash in the callback goroutine.
 func Invoke[R1 any](ctx context.Context, fn func() (R1, error)) (R1, error) {
 	return Invoke1(ctx, fn)
 }
@@ -0,0 +1,122 @@
+package fo
+
+import (
+	"context"
+)
+
+// InvokeWithContext0 has the same behavior as InvokeWithContext but without return value.
+func InvokeWithContext0(ctx context.Context, fn func(ctx context.Context) error, opts ...CallInvokeWithOption) error {
+	_, err := invokeContextWithCallOptions(ctx, func(ctx context.Context) (any, error) {
+		return nil, fn(ctx)
+	}, opts...)
+
+	return err
+}
+
+// InvokeWithContext invokes the context-aware callback function with ctx as parent context
+// and the CallInvokeWithOption passed in, and enables to control the context of the callback
+// function with 1 return value and an error. The context passed to the callback function is
+// done when the invocation times out or ctx is done, and carries the span of the invocation
+// so that the nested invocations can be traced as its children.
+func InvokeWithContext[R1 any](ctx context.Context, fn func(ctx context.Context) (R1, error), opts ...CallInvokeWithOption) (R1, error) {
+	return InvokeWithContext1(ctx, fn, opts...)
+}
+
+// InvokeWithContext1 is an alias of InvokeWithContext.
+func InvokeWithContext1[R1 any](ctx context.Context, fn func(ctx context.Context) (R1, error), opts ...CallInvokeWithOption) (R1, error) {
+	type result struct {
+		R1 R1 `json:"r1"`
+	}
+
+	res, err := invokeContextWithCallOptions(ctx, func(ctx context.Context) (result, error) {
+		r1, err := fn(ctx)
+		return result{R1: r1}, err
+	}, opts...)
+
+	return res.R1, err
+}
+
+// InvokeWithContext2 has the same behavior as InvokeWithContext but with 2 return values.
+func InvokeWithContext2[R1 any, R2 any](ctx context.Context, fn func(ctx context.Context) (R1, R2, error), opts ...CallInvokeWithOption) (R1, R2, error) {
+	type result struct {
+		R1 R1 `json:"r1"`
+		R2 R2 `json:"r2"`
+	}
+
+	res, err := invokeContextWithCallOptions(ctx, func(ctx context.Context) (result, error) {
+		r1, r2, err := fn(ctx)
+		return result{R1: r1, R2: r2}, err
+	}, opts...)
+
+	return res.R1, res.R2, err
+}
+
+// InvokeWithContext3 has the same behavior as InvokeWithContext but with 3 return values.
+func InvokeWithContext3[R1 any, R2 any, R3 any](ctx context.Context, fn func(ctx context.Context) (R1, R2, R3, error), opts ...CallInvokeWithOption) (R1, R2, R3, error) {
+	type result struct {
+		R1 R1 `json:"r1"`
+		R2 R2 `json:"r2"`
+		R3 R3 `json:"r3"`
+	}
+
+	res, err := invokeContextWithCallOptions(ctx, func(ctx context.Context) (result, error) {
+		r1, r2, r3, err := fn(ctx)
+		return result{R1: r1, R2: r2, R3: r3}, err
+	}, opts...)
+
+	return res.R1, res.R2, res.R3, err
+}
+
+// InvokeWithContext4 has the same behavior as InvokeWithContext but with 4 return values.
+func InvokeWithContext4[R1 any, R2 any, R3 any, R4 any](ctx context.Context, fn func(ctx context.Context) (R1, R2, R3, R4, error), opts ...CallInvokeWithOption) (R1, R2, R3, R4, error) {
+	type result struct {
+		R1 R1 `json:"r1"`
+		R2 R2 `json:"r2"`
+		R3 R3 `json:"r3"`
+		R4 R4 `json:"r4"`
+	}
+
+	res, err := invokeContextWithCallOptions(ctx, func(ctx context.Context) (result, error) {
+		r1, r2, r3, r4, err := fn(ctx)
+		return result{R1: r1, R2: r2, R3: r3, R4: r4}, err
+	}, opts...)
+
+	return res.R1, res.R2, res.R3, res.R4, err
+}
+
+// InvokeWithContext5 has the same behavior as InvokeWithContext but with 5 return values.
+func InvokeWithContext5[R1 any, R2 any, R3 any, R4 any, R5 any](ctx context.Context, fn func(ctx context.Context) (R1, R2, R3, R4, R5, error), opts ...CallInvokeWithOption) (R1, R2, R3, R4, R5, error) {
+	type result struct {
+		R1 R1 `json:"r1"`
+		R2 R2 `json:"r2"`
+		R3 R3 `json:"r3"`
+		R4 R4 `json:"r4"`
+		R5 R5 `json:"r5"`
+	}
+
+	res, err := invokeContextWithCallOptions(ctx, func(ctx context.Context) (result, error) {
+		r1, r2, r3, r4, r5, err := fn(ctx)
+		return result{R1: r1, R2: r2, R3: r3, R4: r4, R5: r5}, err
+	}, opts...)
+
+	return res.R1, res.R2, res.R3, res.R4, res.R5, err
+}
+
+// InvokeWithContext6 has the same behavior as InvokeWithContext but with 6 return values.
+func InvokeWithContext6[R1 any, R2 any, R3 any, R4 any, R5 any, R6 any](ctx context.Context, fn func(ctx context.Context) (R1, R2, R3, R4, R5, R6, error), opts ...CallInvokeWithOption) (R1, R2, R3, R4, R5, R6, error) {
+	type result struct {
+		R1 R1 `json:"r1"`
+		R2 R2 `json:"r2"`
+		R3 R3 `json:"r3"`
+		R4 R4 `json:"r4"`
+		R5 R5 `json:"r5"`
+		R6 R6 `json:"r6"`
+	}
+
+	res, err := invokeContextWithCallOptions(ctx, func(ctx context.Context) (result, error) {
+		r1, r2, r3, r4, r5, r6, err := fn(ctx)
+		return result{R1: r1, R2: r2, R3: r3, R4: r4, R5: r5, R6: r6}, err
+	}, opts...)
+
+	return res.R1, res.R2, res.R3, res.R4, res.R5, res.R6, err
+}
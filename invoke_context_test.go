@@ -0,0 +1,60 @@
+package fo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvokeWithContext(t *testing.T) {
+	t.Parallel()
+
+	type contextKey struct{}
+
+	t.Run("Values", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.WithValue(context.Background(), contextKey{}, "foo")
+
+		r1, r2, r3, r4, r5, r6, err := InvokeWithContext6(ctx, func(ctx context.Context) (string, int, bool, float64, *testStruct, map[string]string, error) {
+			value, _ := ctx.Value(contextKey{}).(string)
+			return value, 1, true, 1.1, &testStruct{name: "foo"}, map[string]string{"foo": "bar"}, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "foo", r1)
+		assert.Equal(t, 1, r2)
+		assert.True(t, r3)
+		assert.InEpsilon(t, 1.1, r4, 0.0001)
+		assert.Equal(t, &testStruct{name: "foo"}, r5)
+		assert.Equal(t, map[string]string{"foo": "bar"}, r6)
+
+		err = InvokeWithContext0(ctx, func(ctx context.Context) error {
+			return assert.AnError
+		})
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		t.Parallel()
+
+		done := make(chan error, 1)
+
+		_, err := InvokeWithContext(context.Background(), func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			done <- ctx.Err()
+
+			return "", ctx.Err()
+		}, WithContextTimeout(10*time.Millisecond))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		select {
+		case err := <-done:
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+		case <-time.After(time.Second):
+			assert.Fail(t, "callback context is not done")
+		}
+	})
+}
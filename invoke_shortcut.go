@@ -2,12 +2,75 @@ package fo
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"time"
 )
 
 type invokeWithOptions struct {
 	contextTimeout      time.Duration
 	contextTimeoutIsSet bool
+
+	name      string
+	nameIsSet bool
+
+	registry      *Registry
+	registryIsSet bool
+
+	faultInjector      *FaultInjector
+	faultInjectorIsSet bool
+
+	recordKey      string
+	recordKeyIsSet bool
+
+	recorder      *Recorder
+	recorderIsSet bool
+
+	replayer      *Replayer
+	replayerIsSet bool
+
+	captureTimeoutStack      bool
+	captureTimeoutStackIsSet bool
+
+	watchdogInterval time.Duration
+	watchdogHandler  WatchdogHandler
+	watchdogIsSet    bool
+
+	idleTimeout      time.Duration
+	idleTimeoutIsSet bool
+
+	tracker      *Tracker
+	trackerIsSet bool
+
+	journal      *Journal
+	journalIsSet bool
+
+	idempotencyKey      string
+	idempotencyStore    IdempotencyStore
+	idempotencyKeyIsSet bool
+
+	scheduler      *Scheduler
+	tenant         string
+	schedulerIsSet bool
+
+	minRemaining      time.Duration
+	minRemainingIsSet bool
+
+	expectedDuration      time.Duration
+	expectedDurationIsSet bool
+
+	sheddingHistogram    *LatencyHistogram
+	sheddingQuantile     float64
+	latencySheddingIsSet bool
+
+	adaptiveTimeout      *adaptiveTimeout
+	adaptiveTimeoutIsSet bool
+
+	resultsDecoder resultsDecoder
+
+	labels []string
+
+	observers []Observer
 }
 
 type callInvokeWithOptionType int
@@ -15,6 +78,26 @@ type callInvokeWithOptionType int
 const (
 	callInvokeWithOptionTypeContextDefault callInvokeWithOptionType = iota
 	callInvokeWithOptionTypeContextTimeout
+	callInvokeWithOptionTypeName
+	callInvokeWithOptionTypeRegistry
+	callInvokeWithOptionTypeFaultInjection
+	callInvokeWithOptionTypeRecordKey
+	callInvokeWithOptionTypeRecorder
+	callInvokeWithOptionTypeReplayer
+	callInvokeWithOptionTypeLabels
+	callInvokeWithOptionTypeObservers
+	callInvokeWithOptionTypeTimeoutStackCapture
+	callInvokeWithOptionTypeWatchdog
+	callInvokeWithOptionTypeIdleTimeout
+	callInvokeWithOptionTypeTracker
+	callInvokeWithOptionTypeJournal
+	callInvokeWithOptionTypeIdempotencyKey
+	callInvokeWithOptionTypeScheduler
+	callInvokeWithOptionTypeMinRemaining
+	callInvokeWithOptionTypeExpectedDuration
+	callInvokeWithOptionTypeLatencyShedding
+	callInvokeWithOptionTypeAdaptiveTimeout
+	callInvokeWithOptionTypeResultsDecoder
 )
 
 type CallInvokeWithOption struct {
@@ -34,31 +117,503 @@ func WithContextTimeout(timeout time.Duration) CallInvokeWithOption {
 	}
 }
 
-func invokeWithCallOptions[R any](fn func() (R, error), callOpts ...CallInvokeWithOption) (R, error) {
-	ctx := context.Background()
-	cancelFuncs := make([]context.CancelFunc, 0, len(callOpts))
+// WithName names the invocation, the policy registered with the same
+// name in the Registry (see SetRegistry and WithRegistry) will be applied
+// to the invocation.
+func WithName(name string) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeName,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				name:      name,
+				nameIsSet: true,
+			}
+		},
+	}
+}
+
+// WithRegistry sets the Registry to look up the policy of named
+// invocations from, instead of the package level one set by SetRegistry.
+func WithRegistry(registry *Registry) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeRegistry,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				registry:      registry,
+				registryIsSet: true,
+			}
+		},
+	}
+}
+
+// WithFaultInjection enables the fault injection of the invocation with
+// the FaultInjector, instead of the package level one set by
+// SetFaultInjector. Passing nil disables the fault injection.
+func WithFaultInjection(injector *FaultInjector) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeFaultInjection,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				faultInjector:      injector,
+				faultInjectorIsSet: true,
+			}
+		},
+	}
+}
+
+// WithRecordKey sets the key of the invocation for recording and
+// replaying, it is used to distinguish the invocations with the same
+// name but different arguments.
+func WithRecordKey(key string) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeRecordKey,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				recordKey:      key,
+				recordKeyIsSet: true,
+			}
+		},
+	}
+}
+
+// WithRecorder records the named invocation with the Recorder, instead
+// of the package level one set by SetRecorder. Passing nil disables the
+// recording.
+func WithRecorder(recorder *Recorder) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeRecorder,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				recorder:      recorder,
+				recorderIsSet: true,
+			}
+		},
+	}
+}
+
+// WithReplayer replays the named invocation with the Replayer, instead
+// of the package level one set by SetReplayer. Passing nil disables the
+// replaying.
+func WithReplayer(replayer *Replayer) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeReplayer,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				replayer:      replayer,
+				replayerIsSet: true,
+			}
+		},
+	}
+}
+
+// WithLabels sets the pprof labels of the callback goroutine in addition
+// to the built-in LabelName and LabelCaller ones, the labels are
+// specified as key-value pairs like pprof.Labels(...). Multiple
+// WithLabels(...) options are appended together. The callback goroutine
+// is labeled even if SetProfilingLabels(...) is not enabled.
+//
+// It panics if the number of the arguments is odd.
+func WithLabels(keyValues ...string) CallInvokeWithOption {
+	if len(keyValues)%2 != 0 {
+		panic("fo: WithLabels requires an even number of arguments as key-value pairs")
+	}
+
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeLabels,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				labels: keyValues,
+			}
+		},
+	}
+}
+
+// WithObservers adds the observers for the invocation in addition to the
+// global ones set by SetObservers(...).
+func WithObservers(observer ...Observer) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeObservers,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				observers: observer,
+			}
+		},
+	}
+}
+
+// WithTimeoutStackCapture captures the stack trace of the callback
+// goroutine when the context is done before the callback function
+// returns, and returns it as *TimeoutError, which wraps the error of the
+// context, so that the line where the callback function was blocked can
+// be found. Capturing the stack trace stops the world briefly, so it is
+// disabled by default.
+func WithTimeoutStackCapture() CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeTimeoutStackCapture,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				captureTimeoutStack:      true,
+				captureTimeoutStackIsSet: true,
+			}
+		},
+	}
+}
+
+// newInvokeWithOptions merges the call options into a single
+// invokeWithOptions, the later option overrides the former one, except
+// for timeouts, the shortest positive timeout wins, and labels and
+// observers, which are appended together.
+func newInvokeWithOptions(callOpts ...CallInvokeWithOption) *invokeWithOptions {
+	merged := &invokeWithOptions{}
 
 	for _, callOpt := range callOpts {
 		options := callOpt.options()
-		if options.contextTimeoutIsSet {
-			timeout := options.contextTimeout
-			if timeout <= 0 {
-				continue
+
+		if options.contextTimeoutIsSet && options.contextTimeout > 0 {
+			if !merged.contextTimeoutIsSet || options.contextTimeout < merged.contextTimeout {
+				merged.contextTimeout = options.contextTimeout
+				merged.contextTimeoutIsSet = true
 			}
+		}
+		if options.nameIsSet {
+			merged.name = options.name
+			merged.nameIsSet = true
+		}
+		if options.registryIsSet {
+			merged.registry = options.registry
+			merged.registryIsSet = true
+		}
+		if options.faultInjectorIsSet {
+			merged.faultInjector = options.faultInjector
+			merged.faultInjectorIsSet = true
+		}
+		if options.recordKeyIsSet {
+			merged.recordKey = options.recordKey
+			merged.recordKeyIsSet = true
+		}
+		if options.recorderIsSet {
+			merged.recorder = options.recorder
+			merged.recorderIsSet = true
+		}
+		if options.replayerIsSet {
+			merged.replayer = options.replayer
+			merged.replayerIsSet = true
+		}
+		if options.captureTimeoutStackIsSet {
+			merged.captureTimeoutStack = options.captureTimeoutStack
+			merged.captureTimeoutStackIsSet = true
+		}
+		if options.watchdogIsSet {
+			merged.watchdogInterval = options.watchdogInterval
+			merged.watchdogHandler = options.watchdogHandler
+			merged.watchdogIsSet = true
+		}
+		if options.idleTimeoutIsSet {
+			merged.idleTimeout = options.idleTimeout
+			merged.idleTimeoutIsSet = true
+		}
+		if options.trackerIsSet {
+			merged.tracker = options.tracker
+			merged.trackerIsSet = true
+		}
+		if options.journalIsSet {
+			merged.journal = options.journal
+			merged.journalIsSet = true
+		}
+		if options.idempotencyKeyIsSet {
+			merged.idempotencyKey = options.idempotencyKey
+			merged.idempotencyStore = options.idempotencyStore
+			merged.idempotencyKeyIsSet = true
+		}
+		if options.schedulerIsSet {
+			merged.scheduler = options.scheduler
+			merged.tenant = options.tenant
+			merged.schedulerIsSet = true
+		}
+		if options.minRemainingIsSet {
+			merged.minRemaining = options.minRemaining
+			merged.minRemainingIsSet = true
+		}
+		if options.expectedDurationIsSet {
+			merged.expectedDuration = options.expectedDuration
+			merged.expectedDurationIsSet = true
+		}
+		if options.latencySheddingIsSet {
+			merged.sheddingHistogram = options.sheddingHistogram
+			merged.sheddingQuantile = options.sheddingQuantile
+			merged.latencySheddingIsSet = true
+		}
+		if options.adaptiveTimeoutIsSet {
+			merged.adaptiveTimeout = options.adaptiveTimeout
+			merged.adaptiveTimeoutIsSet = true
+		}
+		if options.resultsDecoder != nil {
+			merged.resultsDecoder = options.resultsDecoder
+		}
+		if len(options.labels) > 0 {
+			merged.labels = append(merged.labels, options.labels...)
+		}
+		if len(options.observers) > 0 {
+			merged.observers = append(merged.observers, options.observers...)
+		}
+	}
+
+	return merged
+}
+
+// policy looks up the state of the policy registered for the name of
+// the invocation, returns nil if the invocation is not named or there
+// is no policy registered for it.
+func (o *invokeWithOptions) policy() *policyState {
+	if !o.nameIsSet {
+		return nil
+	}
 
-			var cancel context.CancelFunc
-			ctx, cancel = context.WithTimeout(ctx, timeout)
-			cancelFuncs = append(cancelFuncs, cancel)
+	registry := o.registry
+	if !o.registryIsSet {
+		registry = currentRegistry()
+	}
+	if registry == nil {
+		return nil
+	}
+
+	return registry.lookup(o.name)
+}
+
+// injector returns the FaultInjector for the invocation, or nil if the
+// fault injection is not enabled.
+func (o *invokeWithOptions) injector() *FaultInjector {
+	if o.faultInjectorIsSet {
+		return o.faultInjector
+	}
+
+	return currentFaultInjector()
+}
+
+// cassette returns the Recorder and Replayer for the invocation, both of
+// them are nil if the invocation is not named.
+func (o *invokeWithOptions) cassette() (*Recorder, *Replayer) {
+	if !o.nameIsSet {
+		return nil, nil
+	}
+
+	recorder := o.recorder
+	if !o.recorderIsSet {
+		recorder = currentRecorder()
+	}
+
+	replayer := o.replayer
+	if !o.replayerIsSet {
+		replayer = currentReplayer()
+	}
+
+	return recorder, replayer
+}
+
+func invokeWithCallOptions[R any](fn func() (R, error), callOpts ...CallInvokeWithOption) (R, error) {
+	return invokeContextWithCallOptions(context.Background(), func(context.Context) (R, error) {
+		return fn()
+	}, callOpts...)
+}
+
+// invokeContextWithCallOptions invokes the context-aware fn with ctx as
+// parent context and the call options applied.
+func invokeContextWithCallOptions[R any](ctx context.Context, fn func(ctx context.Context) (R, error), callOpts ...CallInvokeWithOption) (R, error) {
+	options := newInvokeWithOptions(callOpts...)
+	call := newInvocation(options)
+
+	recorder, replayer := options.cassette()
+	if replayer != nil {
+		return replay[R](replayer, options.name, options.recordKey, options.resultsDecoder)
+	}
+
+	invoke := func(fn func(ctx context.Context) (R, error)) (R, error) {
+		if recorder == nil {
+			return invokeWithPolicy(ctx, call, fn, options)
 		}
+
+		start := time.Now()
+		res, err := invokeWithPolicy(ctx, call, fn, options)
+		recorder.record(options.name, options.recordKey, res, err, time.Since(start))
+
+		return res, err
 	}
 
-	defer func() {
-		for _, cancel := range cancelFuncs {
-			cancel()
+	if options.journal != nil && options.nameIsSet {
+		next := invoke
+		invoke = func(fn func(ctx context.Context) (R, error)) (R, error) {
+			return journaled(options.journal, options.name, options.recordKey, options.resultsDecoder, fn, next)
 		}
-	}()
+	}
+	if options.idempotencyStore != nil && options.idempotencyKey != "" {
+		return idempotent(ctx, options.idempotencyStore, options.idempotencyKey, options.resultsDecoder, fn, invoke)
+	}
+
+	return invoke(fn)
+}
+
+// invokeWithPolicy invokes fn with the fault injection and the policy
+// of the invocation applied.
+func invokeWithPolicy[R any](ctx context.Context, call *invocation, fn func(ctx context.Context) (R, error), options *invokeWithOptions) (R, error) {
+	injector := options.injector()
+
+	state := options.policy()
+	timeout := options.attemptTimeout(state)
 
-	return invoke(ctx, fn)
+	if state == nil {
+		return invokeAttempt(ctx, call, injectFault(injector, options.name, fn), timeout, nil)
+	}
+
+	var res R
+	var err error
+
+	for attempt := 0; attempt <= state.policy.Retries; attempt++ {
+		if attempt > 0 && state.policy.RetryBackoff > 0 {
+			timer := time.NewTimer(state.policy.RetryBackoff.Duration())
+
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return res, err
+			case <-timer.C:
+			}
+		}
+
+		res, err = invokeAttempt(ctx, call.withAttempt(attempt+1), injectFault(injector, options.name, fn), timeout, state)
+		if err == nil || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrShuttingDown) || errors.Is(err, ErrInsufficientTime) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	return res, err
+}
+
+// attemptTimeout returns the timeout of each attempt. The adaptive
+// timeout overrides the timeout of the policy and is capped by the one
+// set by WithContextTimeout(...).
+func (o *invokeWithOptions) attemptTimeout(state *policyState) time.Duration {
+	if o.adaptiveTimeout != nil {
+		timeout := o.adaptiveTimeout.timeout()
+		if o.contextTimeoutIsSet && (timeout <= 0 || o.contextTimeout < timeout) {
+			timeout = o.contextTimeout
+		}
+
+		return timeout
+	}
+	if state != nil && !o.contextTimeoutIsSet {
+		return state.policy.Timeout.Duration()
+	}
+
+	return o.contextTimeout
+}
+
+// invokeAttempt invokes fn once with ctx as parent context, applies the
+// timeout and the idle timeout if they are positive, and goes through the
+// circuit breaker and concurrency limit of the policy and the scheduler
+// if any. The invocation is refused with ErrInsufficientTime before and
+// after waiting for the slots if the remaining time is too short.
+func invokeAttempt[R any](ctx context.Context, call *invocation, fn func(ctx context.Context) (R, error), timeout time.Duration, state *policyState) (res R, err error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+
+		defer cancel()
+	}
+	if call.idleTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = withIdleTimeout(ctx, call.idleTimeout)
+
+		defer cancel()
+	}
+
+	var empty R
+
+	err = call.admitRemaining(ctx)
+	if err != nil {
+		return empty, err
+	}
+
+	releases := make([]func(), 0, 2)
+
+	if state != nil {
+		release, err := state.acquire(ctx)
+		if err != nil {
+			return empty, err
+		}
+
+		fn, release = releaseOnReturn(fn, release)
+		releases = append(releases, release)
+	}
+	if call.scheduler != nil {
+		release, err := call.scheduler.acquire(ctx, call.tenant)
+		if err != nil {
+			releaseAll(releases)
+			return empty, err
+		}
+
+		fn, release = releaseOnReturn(fn, release)
+		releases = append(releases, release)
+	}
+	// the remaining time may have run short while waiting for the slots
+	if len(releases) > 0 {
+		err = call.admitRemaining(ctx)
+		if err != nil {
+			releaseAll(releases)
+			return empty, err
+		}
+	}
+	// the breaker is asked last, so that the trial call of the half-open
+	// breaker is never given up before it is reported with done(...)
+	if state != nil && state.breaker != nil {
+		if !state.breaker.allow() {
+			releaseAll(releases)
+			return empty, ErrCircuitOpen
+		}
+
+		// the panics of fn are re-panicked by invokeCall, and count as
+		// failures so that the half-open breaker is never left stuck
+		defer func() {
+			v := recover()
+			if v != nil {
+				panicErr := newPanicError(v)
+				state.breaker.done(panicErr)
+				panic(panicErr)
+			}
+
+			state.breaker.done(err)
+		}()
+	}
+
+	start := time.Now()
+
+	res, err = invokeCall(ctx, call, fn)
+	// fn is never called if the invocation is rejected by the tracker,
+	// while the canceled ones release the slots once fn returns
+	if errors.Is(err, errTrackerRejected) {
+		releaseAll(releases)
+	} else if call.adaptiveTimeout != nil && (err == nil || errors.Is(err, context.DeadlineExceeded)) {
+		call.adaptiveTimeout.sketch.observe(time.Since(start))
+	}
+
+	return res, err
+}
+
+// releaseOnReturn wraps fn to release the slot once it returns, the
+// returned release function can be called again in case fn is never
+// called, the slot will be released only once.
+func releaseOnReturn[R any](fn func(ctx context.Context) (R, error), release func()) (func(ctx context.Context) (R, error), func()) {
+	once := sync.OnceFunc(release)
+
+	return func(ctx context.Context) (R, error) {
+		defer once()
+		return fn(ctx)
+	}, once
+}
+
+func releaseAll(releases []func()) {
+	for _, release := range releases {
+		release()
+	}
 }
 
 // InvokeWith0 has the same behavior as InvokeWith but without return value.
@@ -92,15 +647,15 @@ func InvokeWithTimeout[R1 any](fn func() (R1, error), timeout time.Duration) (R1
 // InvokeWith1 is an alias of InvokeWith.
 func InvokeWith1[R1 any](fn func() (R1, error), opts ...CallInvokeWithOption) (R1, error) {
 	type result struct {
-		r1 R1
+		R1 R1 `json:"r1"`
 	}
 
 	res, err := invokeWithCallOptions(func() (result, error) {
 		r1, err := fn()
-		return result{r1: r1}, err
+		return result{R1: r1}, err
 	}, opts...)
 
-	return res.r1, err
+	return res.R1, err
 }
 
 // InvokeWithTimeout1 is an alias of InvokeWithTimeout.
@@ -111,16 +666,16 @@ func InvokeWithTimeout1[R1 any](fn func() (R1, error), timeout time.Duration) (R
 // InvokeWith2 has the same behavior as InvokeWith but with 2 return values.
 func InvokeWith2[R1 any, R2 any](fn func() (R1, R2, error), opts ...CallInvokeWithOption) (R1, R2, error) {
 	type result struct {
-		r1 R1
-		r2 R2
+		R1 R1 `json:"r1"`
+		R2 R2 `json:"r2"`
 	}
 
 	res, err := invokeWithCallOptions(func() (result, error) {
 		r1, r2, err := fn()
-		return result{r1: r1, r2: r2}, err
+		return result{R1: r1, R2: r2}, err
 	}, opts...)
 
-	return res.r1, res.r2, err
+	return res.R1, res.R2, err
 }
 
 // InvokeWithTimeout2 has the same behavior as InvokeWithTimeout but with 2 return values.
@@ -131,17 +686,17 @@ func InvokeWithTimeout2[R1 any, R2 any](fn func() (R1, R2, error), timeout time.
 // InvokeWith3 has the same behavior as InvokeWith but with 3 return values.
 func InvokeWith3[R1 any, R2 any, R3 any](fn func() (R1, R2, R3, error), opts ...CallInvokeWithOption) (R1, R2, R3, error) {
 	type result struct {
-		r1 R1
-		r2 R2
-		r3 R3
+		R1 R1 `json:"r1"`
+		R2 R2 `json:"r2"`
+		R3 R3 `json:"r3"`
 	}
 
 	res, err := invokeWithCallOptions(func() (result, error) {
 		r1, r2, r3, err := fn()
-		return result{r1: r1, r2: r2, r3: r3}, err
+		return result{R1: r1, R2: r2, R3: r3}, err
 	}, opts...)
 
-	return res.r1, res.r2, res.r3, err
+	return res.R1, res.R2, res.R3, err
 }
 
 // InvokeWithTimeout3 has the same behavior as InvokeWithTimeout but with 3 return values.
@@ -152,18 +707,18 @@ func InvokeWithTimeout3[R1 any, R2 any, R3 any](fn func() (R1, R2, R3, error), t
 // InvokeWith4 has the same behavior as InvokeWith but with 4 return values.
 func InvokeWith4[R1 any, R2 any, R3 any, R4 any](fn func() (R1, R2, R3, R4, error), opts ...CallInvokeWithOption) (R1, R2, R3, R4, error) {
 	type result struct {
-		r1 R1
-		r2 R2
-		r3 R3
-		r4 R4
+		R1 R1 `json:"r1"`
+		R2 R2 `json:"r2"`
+		R3 R3 `json:"r3"`
+		R4 R4 `json:"r4"`
 	}
 
 	res, err := invokeWithCallOptions(func() (result, error) {
 		r1, r2, r3, r4, err := fn()
-		return result{r1: r1, r2: r2, r3: r3, r4: r4}, err
+		return result{R1: r1, R2: r2, R3: r3, R4: r4}, err
 	}, opts...)
 
-	return res.r1, res.r2, res.r3, res.r4, err
+	return res.R1, res.R2, res.R3, res.R4, err
 }
 
 // InvokeWithTimeout4 has the same behavior as InvokeWithTimeout but with 4 return values.
@@ -174,19 +729,19 @@ func InvokeWithTimeout4[R1 any, R2 any, R3 any, R4 any](fn func() (R1, R2, R3, R
 // InvokeWith5 has the same behavior as InvokeWith but with 5 return values.
 func InvokeWith5[R1 any, R2 any, R3 any, R4 any, R5 any](fn func() (R1, R2, R3, R4, R5, error), opts ...CallInvokeWithOption) (R1, R2, R3, R4, R5, error) {
 	type result struct {
-		r1 R1
-		r2 R2
-		r3 R3
-		r4 R4
-		r5 R5
+		R1 R1 `json:"r1"`
+		R2 R2 `json:"r2"`
+		R3 R3 `json:"r3"`
+		R4 R4 `json:"r4"`
+		R5 R5 `json:"r5"`
 	}
 
 	res, err := invokeWithCallOptions(func() (result, error) {
 		r1, r2, r3, r4, r5, err := fn()
-		return result{r1: r1, r2: r2, r3: r3, r4: r4, r5: r5}, err
+		return result{R1: r1, R2: r2, R3: r3, R4: r4, R5: r5}, err
 	}, opts...)
 
-	return res.r1, res.r2, res.r3, res.r4, res.r5, err
+	return res.R1, res.R2, res.R3, res.R4, res.R5, err
 }
 
 // InvokeWithTimeout5 has the same behavior as InvokeWithTimeout but with 5 return values.
@@ -197,20 +752,20 @@ func InvokeWithTimeout5[R1 any, R2 any, R3 any, R4 any, R5 any](fn func() (R1, R
 // InvokeWith6 has the same behavior as InvokeWith but with 6 return values.
 func InvokeWith6[R1 any, R2 any, R3 any, R4 any, R5 any, R6 any](fn func() (R1, R2, R3, R4, R5, R6, error), opts ...CallInvokeWithOption) (R1, R2, R3, R4, R5, R6, error) {
 	type result struct {
-		r1 R1
-		r2 R2
-		r3 R3
-		r4 R4
-		r5 R5
-		r6 R6
+		R1 R1 `json:"r1"`
+		R2 R2 `json:"r2"`
+		R3 R3 `json:"r3"`
+		R4 R4 `json:"r4"`
+		R5 R5 `json:"r5"`
+		R6 R6 `json:"r6"`
 	}
 
 	res, err := invokeWithCallOptions(func() (result, error) {
 		r1, r2, r3, r4, r5, r6, err := fn()
-		return result{r1: r1, r2: r2, r3: r3, r4: r4, r5: r5, r6: r6}, err
+		return result{R1: r1, R2: r2, R3: r3, R4: r4, R5: r5, R6: r6}, err
 	}, opts...)
 
-	return res.r1, res.r2, res.r3, res.r4, res.r5, res.r6, err
+	return res.R1, res.R2, res.R3, res.R4, res.R5, res.R6, err
 }
 
 // InvokeWithTimeout6 has the same behavior as InvokeWithTimeout but with 6 return values.
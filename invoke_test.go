@@ -381,3 +381,70 @@ func BenchmarkInvoke(b *testing.B) {
 		})
 	}
 }
+
+func TestInvokePanic(t *testing.T) {
+	t.Parallel()
+
+	t.Run("RepanicInCaller", func(t *testing.T) {
+		t.Parallel()
+
+		defer func() {
+			r := recover()
+			require.NotNil(t, r)
+
+			panicErr, ok := r.(*PanicError)
+			require.True(t, ok)
+			assert.Equal(t, "something went wrong", panicErr.Value)
+			assert.Contains(t, string(panicErr.Stack), "invoke_test.go")
+		}()
+
+		_, _ = invoke(context.Background(), func() (any, error) {
+			panic("something went wrong")
+		})
+	})
+
+	t.Run("ReturnsBeforeTimeout", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		res, err := invoke(ctx, func() (string, error) {
+			return "foo", nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "foo", res)
+	})
+}
+
+func TestInFlightAndAbandonedInvocations(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	inFlight := InFlightInvocations()
+	abandoned := AbandonedInvocations()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	_, err := invoke(ctx, func() (any, error) {
+		close(started)
+		<-release
+
+		return nil, nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+
+	assert.GreaterOrEqual(t, InFlightInvocations(), inFlight+1)
+	assert.GreaterOrEqual(t, AbandonedInvocations(), abandoned+1)
+
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		return InFlightInvocations() <= inFlight && AbandonedInvocations() <= abandoned
+	}, time.Second, time.Millisecond)
+}
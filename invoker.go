@@ -0,0 +1,293 @@
+package fo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Invoker invokes callback functions with context control and call
+// options applied. The package level Invoke* and InvokeWith* functions
+// cannot be swapped in tests, services can depend on Invoker instead,
+// use NewInvoker() in production and inject a SyncInvoker or a
+// MockInvoker in tests.
+//
+// Use Do(...) and Do0(...) for typed results.
+type Invoker interface {
+	Do(ctx context.Context, fn func(ctx context.Context) (any, error), opts ...CallInvokeWithOption) (any, error)
+}
+
+var (
+	_ Invoker = (*defaultInvoker)(nil)
+	_ Invoker = (*SyncInvoker)(nil)
+	_ Invoker = (*MockInvoker)(nil)
+)
+
+type defaultInvoker struct{}
+
+// NewInvoker creates the default Invoker, which behaves the same as
+// InvokeWith(...) but with ctx as parent context instead of
+// context.Background().
+func NewInvoker() Invoker {
+	return &defaultInvoker{}
+}
+
+// Do invokes fn in a new goroutine with the call options applied.
+func (i *defaultInvoker) Do(ctx context.Context, fn func(ctx context.Context) (any, error), opts ...CallInvokeWithOption) (any, error) {
+	return invokeContextWithCallOptions(ctx, fn, opts...)
+}
+
+// SyncInvoker is an Invoker for tests that calls the callback function
+// synchronously in the caller's goroutine without spawning any
+// goroutines. Only the timeout option is applied to the context passed
+// to the callback function, the other options are ignored.
+//
+// Since the callback function always runs to completion, ctx.Err() will
+// be returned instead of its results if ctx is done by the time it
+// returns, the same as the default Invoker would have returned.
+type SyncInvoker struct{}
+
+// NewSyncInvoker creates a new SyncInvoker.
+func NewSyncInvoker() *SyncInvoker {
+	return &SyncInvoker{}
+}
+
+// Do calls fn synchronously.
+func (i *SyncInvoker) Do(ctx context.Context, fn func(ctx context.Context) (any, error), opts ...CallInvokeWithOption) (any, error) {
+	options := newInvokeWithOptions(opts...)
+	if options.contextTimeoutIsSet {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.contextTimeout)
+
+		defer cancel()
+	}
+
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := fn(ctx)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return res, err
+}
+
+// InvokerCall is a call recorded by MockInvoker.
+type InvokerCall struct {
+	// Name is the name set by WithName(...).
+	Name string
+	// RecordKey is the key set by WithRecordKey(...).
+	RecordKey string
+	// Timeout is the timeout set by WithContextTimeout(...).
+	Timeout time.Duration
+	// Options are the call options passed in.
+	Options []CallInvokeWithOption
+}
+
+type mockInvokerStub struct {
+	result any
+	err    error
+}
+
+// MockInvoker is an Invoker for tests that records every call, so that
+// tests can assert which calls happened with which options. The calls
+// whose names are stubbed with On(...) will be served with the stubbed
+// results without calling the callback functions, the others will be
+// passed to a SyncInvoker.
+type MockInvoker struct {
+	mutex   sync.Mutex
+	calls   []InvokerCall
+	stubs   map[string]mockInvokerStub
+	invoker Invoker
+}
+
+// NewMockInvoker creates a new MockInvoker.
+func NewMockInvoker() *MockInvoker {
+	return &MockInvoker{
+		calls:   make([]InvokerCall, 0),
+		stubs:   make(map[string]mockInvokerStub),
+		invoker: NewSyncInvoker(),
+	}
+}
+
+// On stubs the calls named with name by WithName(...) to return result
+// and err without calling the callback functions.
+func (m *MockInvoker) On(name string, result any, err error) *MockInvoker {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.stubs[name] = mockInvokerStub{result: result, err: err}
+
+	return m
+}
+
+// Calls returns all the recorded calls in order.
+func (m *MockInvoker) Calls() []InvokerCall {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	calls := make([]InvokerCall, len(m.calls))
+	copy(calls, m.calls)
+
+	return calls
+}
+
+// CallsNamed returns the recorded calls named with name in order.
+func (m *MockInvoker) CallsNamed(name string) []InvokerCall {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	calls := make([]InvokerCall, 0)
+
+	for _, call := range m.calls {
+		if call.Name == name {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// Reset clears the recorded calls and the stubs.
+func (m *MockInvoker) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.calls = make([]InvokerCall, 0)
+	m.stubs = make(map[string]mockInvokerStub)
+}
+
+// Do records the call and serves it with the stub if any.
+func (m *MockInvoker) Do(ctx context.Context, fn func(ctx context.Context) (any, error), opts ...CallInvokeWithOption) (any, error) {
+	options := newInvokeWithOptions(opts...)
+
+	m.mutex.Lock()
+	m.calls = append(m.calls, InvokerCall{
+		Name:      options.name,
+		RecordKey: options.recordKey,
+		Timeout:   options.contextTimeout,
+		Options:   callerOptions(opts),
+	})
+	stub, ok := m.stubs[options.name]
+	m.mutex.Unlock()
+
+	if ok {
+		return stub.result, stub.err
+	}
+
+	return m.invoker.Do(ctx, fn, opts...)
+}
+
+// callerOptions returns the call options without the ones added by
+// Do(...) internally.
+func callerOptions(opts []CallInvokeWithOption) []CallInvokeWithOption {
+	filtered := make([]CallInvokeWithOption, 0, len(opts))
+
+	for _, opt := range opts {
+		if opt.optionType != callInvokeWithOptionTypeResultsDecoder {
+			filtered = append(filtered, opt)
+		}
+	}
+
+	return filtered
+}
+
+// resultsDecoder decodes the results recorded as JSON by the replayer,
+// the journal or the idempotency store. Since Invoker runs the callback
+// functions with any as the result type, Do(...) sets the decoder of the
+// typed result with withResultsDecoder(...), otherwise the results would
+// be decoded as map[string]any, float64 and so on.
+type resultsDecoder func(data []byte) (any, error)
+
+// decodeResultsAs decodes the results as R.
+func decodeResultsAs[R any](data []byte) (any, error) {
+	var res R
+
+	err := json.Unmarshal(data, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// decodeResults decodes the results as R with the decoder if set.
+func decodeResults[R any](data []byte, decoder resultsDecoder) (R, error) {
+	var res R
+
+	if decoder == nil {
+		err := json.Unmarshal(data, &res)
+		return res, err
+	}
+
+	decoded, err := decoder(data)
+	if err != nil {
+		return res, err
+	}
+
+	res, ok := decoded.(R)
+	if !ok {
+		// the decoder of another type is set for an invocation not run
+		// by Invoker
+		err = json.Unmarshal(data, &res)
+	}
+
+	return res, err
+}
+
+func withResultsDecoder(decoder resultsDecoder) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeResultsDecoder,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				resultsDecoder: decoder,
+			}
+		},
+	}
+}
+
+// assertInvokerResult asserts the result returned by Invoker as R, nil
+// is asserted as the zero value of R.
+func assertInvokerResult[R any](res any, err error) (R, error) {
+	var empty R
+	if res == nil {
+		return empty, err
+	}
+
+	r, ok := res.(R)
+	if !ok {
+		return empty, fmt.Errorf("invoker: unexpected result type %T, expected %T", res, empty)
+	}
+
+	return r, err
+}
+
+// Do0 has the same behavior as Do but without return value.
+func Do0(ctx context.Context, invoker Invoker, fn func(ctx context.Context) error, opts ...CallInvokeWithOption) error {
+	_, err := invoker.Do(ctx, func(ctx context.Context) (any, error) {
+		return nil, fn(ctx)
+	}, opts...)
+
+	return err
+}
+
+// Do invokes the context-aware callback function with the invoker and
+// returns the typed result of it.
+func Do[R1 any](ctx context.Context, invoker Invoker, fn func(ctx context.Context) (R1, error), opts ...CallInvokeWithOption) (R1, error) {
+	return Do1(ctx, invoker, fn, opts...)
+}
+
+// Do1 is an alias of Do.
+func Do1[R1 any](ctx context.Context, invoker Invoker, fn func(ctx context.Context) (R1, error), opts ...CallInvokeWithOption) (R1, error) {
+	res, err := invoker.Do(ctx, func(ctx context.Context) (any, error) {
+		return fn(ctx)
+	}, append(slices.Clip(opts), withResultsDecoder(decodeResultsAs[R1]))...)
+
+	return assertInvokerResult[R1](res, err)
+}
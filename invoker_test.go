@@ -0,0 +1,167 @@
+package fo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type invokerTestService struct {
+	invoker Invoker
+}
+
+func (s *invokerTestService) GetName(ctx context.Context, id int) (string, error) {
+	return Do(ctx, s.invoker, func(ctx context.Context) (string, error) {
+		return fmt.Sprintf("user-%d", id), nil
+	}, WithName("users.get"), WithRecordKey(fmt.Sprint(id)), WithContextTimeout(time.Second))
+}
+
+func TestInvoker(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Default", func(t *testing.T) {
+		t.Parallel()
+
+		invoker := NewInvoker()
+
+		res, err := Do(context.Background(), invoker, func(ctx context.Context) (string, error) {
+			return "foo", nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "foo", res)
+
+		err = Do0(context.Background(), invoker, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}, WithContextTimeout(10*time.Millisecond))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// parent context is respected
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err = Do(ctx, invoker, func(ctx context.Context) (string, error) {
+			time.Sleep(time.Second)
+			return "foo", nil
+		})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		t.Parallel()
+
+		invoker := NewSyncInvoker()
+
+		var called bool
+
+		res, err := Do1(context.Background(), invoker, func(ctx context.Context) (int, error) {
+			called = true
+			return 1, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, res)
+		assert.True(t, called)
+
+		err = Do0(context.Background(), invoker, func(ctx context.Context) error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		}, WithContextTimeout(time.Millisecond))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		err = Do0(context.Background(), invoker, func(ctx context.Context) error {
+			return assert.AnError
+		})
+		assert.Equal(t, assert.AnError, err)
+	})
+
+	t.Run("Mock", func(t *testing.T) {
+		t.Parallel()
+
+		mock := NewMockInvoker()
+		service := &invokerTestService{invoker: mock}
+
+		res, err := service.GetName(context.Background(), 1)
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", res)
+
+		mock.On("users.get", "stubbed", nil)
+
+		res, err = service.GetName(context.Background(), 2)
+		require.NoError(t, err)
+		assert.Equal(t, "stubbed", res)
+
+		calls := mock.CallsNamed("users.get")
+		require.Len(t, calls, 2)
+		assert.Equal(t, "1", calls[0].RecordKey)
+		assert.Equal(t, "2", calls[1].RecordKey)
+		assert.Equal(t, time.Second, calls[1].Timeout)
+		assert.Len(t, calls[1].Options, 3)
+
+		mock.On("users.get", 42, nil)
+
+		_, err = service.GetName(context.Background(), 3)
+		require.Error(t, err)
+		assert.EqualError(t, err, "invoker: unexpected result type int, expected string")
+
+		mock.On("users.get", nil, assert.AnError)
+
+		res, err = service.GetName(context.Background(), 4)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, assert.AnError))
+		assert.Empty(t, res)
+
+		assert.Len(t, mock.Calls(), 4)
+
+		mock.Reset()
+		assert.Empty(t, mock.Calls())
+	})
+	t.Run("Typed results", func(t *testing.T) {
+		t.Parallel()
+
+		type user struct {
+			ID   int64  `json:"id"`
+			Name string `json:"name"`
+		}
+
+		accounts := NewKeyedInvoker[string](NewInvoker())
+		store := NewMemoryIdempotencyStore(time.Minute)
+
+		var calls int
+
+		for range 2 {
+			res, err := Do(context.Background(), accounts.For("account-1"), func(ctx context.Context) (int, error) {
+				calls++
+				return 42, nil
+			}, WithIdempotencyKey("test.invoker.typed", store))
+			require.NoError(t, err)
+			assert.Equal(t, 42, res)
+		}
+
+		assert.Equal(t, 1, calls)
+
+		buffer := new(bytes.Buffer)
+
+		res, err := Do(context.Background(), NewInvoker(), func(ctx context.Context) (user, error) {
+			return user{ID: 1 << 60, Name: "foo"}, nil
+		}, WithName("test.invoker.typed"), WithRecorder(NewRecorder(buffer)))
+		require.NoError(t, err)
+
+		replayer, err := NewReplayer(buffer)
+		require.NoError(t, err)
+
+		replayed, err := Do(context.Background(), NewInvoker(), func(ctx context.Context) (user, error) {
+			return user{}, nil
+		}, WithName("test.invoker.typed"), WithReplayer(replayer))
+		require.NoError(t, err)
+		assert.Equal(t, res, replayed)
+	})
+}
@@ -0,0 +1,470 @@
+package fo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// JournalEntryType is the type of JournalEntry.
+type JournalEntryType string
+
+const (
+	// JournalEntryStart is written before the callback function is
+	// called.
+	JournalEntryStart JournalEntryType = "start"
+	// JournalEntryComplete is written after the callback function
+	// returns, with the results or the error.
+	JournalEntryComplete JournalEntryType = "complete"
+)
+
+// JournalEntry is a single record of the journal.
+type JournalEntry struct {
+	// Seq is the sequence number of the invocation in the journal, the
+	// start and complete entries of the same invocation share it.
+	Seq     uint64           `json:"seq"`
+	Type    JournalEntryType `json:"type"`
+	Name    string           `json:"name"`
+	Key     string           `json:"key,omitempty"`
+	Results json.RawMessage  `json:"results,omitempty"`
+	Error   string           `json:"error,omitempty"`
+	Time    time.Time        `json:"time"`
+}
+
+// JournalStore is the storage backend of Journal. Implementations must be
+// safe for concurrent use, and Append should not return before the entry
+// is durable.
+type JournalStore interface {
+	// Append appends the entry to the journal.
+	Append(entry JournalEntry) error
+	// Entries returns all the entries of the journal in the order they
+	// are appended.
+	Entries() ([]JournalEntry, error)
+}
+
+var (
+	_ JournalStore = (*MemoryJournalStore)(nil)
+	_ JournalStore = (*FileJournalStore)(nil)
+)
+
+// MemoryJournalStore is a JournalStore that keeps the entries in memory,
+// it is meant to be used in tests.
+type MemoryJournalStore struct {
+	mutex   sync.Mutex
+	entries []JournalEntry
+}
+
+// NewMemoryJournalStore creates a new MemoryJournalStore.
+func NewMemoryJournalStore() *MemoryJournalStore {
+	return &MemoryJournalStore{
+		entries: make([]JournalEntry, 0),
+	}
+}
+
+// Append implements JournalStore.
+func (s *MemoryJournalStore) Append(entry JournalEntry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entries = append(s.entries, entry)
+
+	return nil
+}
+
+// Entries implements JournalStore.
+func (s *MemoryJournalStore) Entries() ([]JournalEntry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries := make([]JournalEntry, len(s.entries))
+	copy(entries, s.entries)
+
+	return entries, nil
+}
+
+// FileJournalStore is a JournalStore that appends the entries to a local
+// file as JSON lines, and syncs the file on every append. A torn last line
+// left by a crash is ignored when the entries are read.
+type FileJournalStore struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+// NewFileJournalStore opens or creates the journal file at path, and
+// truncates the torn last line left by a crash if any. The file should be
+// closed with Close(), and can be removed once the workflow is completed.
+func NewFileJournalStore(path string) (*FileJournalStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("journal: failed to open file: %w", err)
+	}
+
+	err = truncateTornLine(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &FileJournalStore{
+		path: path,
+		file: file,
+	}, nil
+}
+
+// Append implements JournalStore.
+func (s *FileJournalStore) Append(entry JournalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("journal: failed to encode entry: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("journal: %w", os.ErrClosed)
+	}
+
+	_, err = s.file.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("journal: failed to write entry: %w", err)
+	}
+
+	err = s.file.Sync()
+	if err != nil {
+		return fmt.Errorf("journal: failed to sync file: %w", err)
+	}
+
+	return nil
+}
+
+// Entries implements JournalStore.
+func (s *FileJournalStore) Entries() ([]JournalEntry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("journal: failed to read file: %w", err)
+	}
+
+	return decodeJournalEntries(data)
+}
+
+// Close closes the journal file.
+func (s *FileJournalStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+// truncateTornLine truncates the file to the end of its last complete
+// line, so that the following appends are not glued to the torn one.
+func truncateTornLine(file *os.File) error {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("journal: failed to read file: %w", err)
+	}
+	if len(data) == 0 || data[len(data)-1] == '\n' {
+		return nil
+	}
+
+	err = file.Truncate(int64(bytes.LastIndexByte(data, '\n') + 1))
+	if err != nil {
+		return fmt.Errorf("journal: failed to truncate torn line: %w", err)
+	}
+
+	return nil
+}
+
+func decodeJournalEntries(data []byte) ([]JournalEntry, error) {
+	entries := make([]JournalEntry, 0)
+	reader := bufio.NewReader(bytes.NewReader(data))
+
+	for line := 1; ; line++ {
+		raw, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("journal: failed to read line %d: %w", line, err)
+		}
+
+		torn := errors.Is(err, io.EOF)
+
+		raw = bytes.TrimSpace(raw)
+		if len(raw) > 0 {
+			var entry JournalEntry
+
+			decodeErr := json.Unmarshal(raw, &entry)
+			if decodeErr != nil {
+				// the last line without the trailing newline is torn by a
+				// crash while appending, it is safe to ignore as the
+				// entry was never acknowledged
+				if torn {
+					return entries, nil
+				}
+
+				return nil, fmt.Errorf("journal: failed to decode line %d: %w", line, decodeErr)
+			}
+
+			entries = append(entries, entry)
+		}
+
+		if torn {
+			return entries, nil
+		}
+	}
+}
+
+type journalKey struct {
+	name string
+	key  string
+}
+
+// Journal is a write-ahead journal of named invocations for the workflows
+// that should be resumable after crashes. Every named invocation made
+// with WithJournal(...) records its start before the callback function is
+// called, and its results after it returns. The callback function that
+// has timed out is recorded once it exits, with the results it actually
+// returned rather than the timeout.
+//
+// When the workflow is re-run with the journal after a restart, the
+// invocations that were completed successfully are served with the
+// recorded results instead of calling the callback functions again, in
+// the order they were recorded for the same name and key set by
+// WithRecordKey(...). The failed and the unfinished ones are called
+// again.
+//
+//	store, err := fo.NewFileJournalStore("orders/" + orderID + ".journal")
+//	journal, err := fo.NewJournal(store)
+//
+//	orderID, err := fo.InvokeWithContext(ctx, createOrder, fo.WithName("order.create"), fo.WithJournal(journal))
+//	_, err = fo.InvokeWithContext(ctx, charge, fo.WithName("payment.charge"), fo.WithJournal(journal))
+type Journal struct {
+	store JournalStore
+
+	mutex     sync.Mutex
+	seq       uint64
+	completed map[journalKey][]JournalEntry
+	pending   []JournalEntry
+}
+
+// NewJournal creates a new Journal with the entries loaded from the store.
+func NewJournal(store JournalStore) (*Journal, error) {
+	entries, err := store.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	journal := &Journal{
+		store:     store,
+		completed: make(map[journalKey][]JournalEntry),
+		pending:   make([]JournalEntry, 0),
+	}
+
+	started := make(map[uint64]JournalEntry)
+
+	for _, entry := range entries {
+		journal.seq = max(journal.seq, entry.Seq)
+
+		switch entry.Type {
+		case JournalEntryStart:
+			started[entry.Seq] = entry
+		case JournalEntryComplete:
+			delete(started, entry.Seq)
+
+			if entry.Error == "" {
+				key := journalKey{name: entry.Name, key: entry.Key}
+				journal.completed[key] = append(journal.completed[key], entry)
+			}
+		}
+	}
+
+	for _, entry := range entries {
+		if _, ok := started[entry.Seq]; ok && entry.Type == JournalEntryStart {
+			journal.pending = append(journal.pending, entry)
+		}
+	}
+
+	return journal, nil
+}
+
+// Pending returns the start entries loaded from the store without the
+// complete entries, which are the invocations interrupted by the crash,
+// their side effects may or may not have taken place.
+func (j *Journal) Pending() []JournalEntry {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	pending := make([]JournalEntry, len(j.pending))
+	copy(pending, j.pending)
+
+	return pending
+}
+
+// next pops the next recorded successful completion of the name and key.
+func (j *Journal) next(name, key string) (JournalEntry, bool) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	k := journalKey{name: name, key: key}
+
+	entries := j.completed[k]
+	if len(entries) == 0 {
+		return JournalEntry{}, false
+	}
+
+	j.completed[k] = entries[1:]
+
+	return entries[0], true
+}
+
+// start appends the start entry of a new invocation and returns its
+// sequence number.
+func (j *Journal) start(name, key string) (uint64, error) {
+	j.mutex.Lock()
+	j.seq++
+	seq := j.seq
+	j.mutex.Unlock()
+
+	return seq, j.store.Append(JournalEntry{
+		Seq:  seq,
+		Type: JournalEntryStart,
+		Name: name,
+		Key:  key,
+		Time: time.Now(),
+	})
+}
+
+// complete appends the complete entry of the invocation.
+func (j *Journal) complete(seq uint64, name, key string, results any, err error) error {
+	entry := JournalEntry{
+		Seq:  seq,
+		Type: JournalEntryComplete,
+		Name: name,
+		Key:  key,
+		Time: time.Now(),
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		encoded, encodeErr := json.Marshal(results)
+		if encodeErr != nil {
+			return fmt.Errorf("journal: failed to encode results of '%s': %w", name, encodeErr)
+		}
+
+		entry.Results = encoded
+	}
+
+	return j.store.Append(entry)
+}
+
+// WithJournal records the named invocation into the journal, and serves
+// it with the recorded results if it was completed successfully in the
+// previous runs. Unnamed invocations are not journaled.
+func WithJournal(journal *Journal) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeJournal,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				journal:      journal,
+				journalIsSet: true,
+			}
+		},
+	}
+}
+
+// journaled serves the invocation from the journal if it was completed,
+// or records the start and the completion of fn invoked with invoke into
+// the journal. The completion is recorded once the invocation returned
+// and none of the attempts of fn is still running, so that the callback
+// function abandoned by the timeout is recorded with its real results
+// when it exits, instead of the timeout that may be followed by its side
+// effects, and stays pending if the process crashes before.
+func journaled[R any](journal *Journal, name, key string, decoder resultsDecoder, fn func(ctx context.Context) (R, error), invoke func(fn func(ctx context.Context) (R, error)) (R, error)) (R, error) {
+	var res R
+
+	entry, ok := journal.next(name, key)
+	if ok {
+		res, err := decodeResults[R](entry.Results, decoder)
+		if err != nil {
+			return res, fmt.Errorf("journal: failed to decode results of '%s': %w", name, err)
+		}
+
+		return res, nil
+	}
+
+	seq, err := journal.start(name, key)
+	if err != nil {
+		return res, err
+	}
+
+	var succeeded R
+	var hasSucceeded bool
+	var exitErr, invokeErr error
+
+	completed := make(chan error, 1)
+	turn := &keyedTurn{release: func() {
+		switch {
+		case hasSucceeded:
+			completed <- journal.complete(seq, name, key, succeeded, nil)
+		case exitErr != nil:
+			completed <- journal.complete(seq, name, key, succeeded, exitErr)
+		default:
+			completed <- journal.complete(seq, name, key, succeeded, invokeErr)
+		}
+	}}
+
+	res, err = invoke(func(ctx context.Context) (R, error) {
+		var empty R
+
+		err := turn.enter(ctx)
+		if err != nil {
+			return empty, err
+		}
+
+		defer turn.exit()
+
+		if hasSucceeded {
+			return succeeded, nil
+		}
+
+		res, err := fn(ctx)
+		if err == nil {
+			succeeded, hasSucceeded = res, true
+		} else {
+			exitErr = err
+		}
+
+		return res, err
+	})
+
+	invokeErr = err
+	turn.done()
+
+	select {
+	case journalErr := <-completed:
+		if journalErr != nil && err == nil {
+			return res, journalErr
+		}
+	default:
+		// completed once the abandoned callback function exits
+	}
+
+	return res, err
+}
@@ -0,0 +1,246 @@
+package fo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Memory", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewMemoryJournalStore()
+
+		var creates, charges atomic.Int32
+
+		workflow := func(journal *Journal, chargeErr error) (string, error) {
+			ctx := context.Background()
+
+			orderID, err := InvokeWithContext(ctx, func(context.Context) (string, error) {
+				creates.Add(1)
+				return "order-1", nil
+			}, WithName("order.create"), WithJournal(journal))
+			if err != nil {
+				return "", err
+			}
+
+			_, err = InvokeWithContext(ctx, func(context.Context) (int, error) {
+				charges.Add(1)
+				return 42, chargeErr
+			}, WithName("payment.charge"), WithRecordKey(orderID), WithJournal(journal))
+
+			return orderID, err
+		}
+
+		journal, err := NewJournal(store)
+		require.NoError(t, err)
+
+		_, err = workflow(journal, assert.AnError)
+		require.ErrorIs(t, err, assert.AnError)
+		assert.Equal(t, int32(1), creates.Load())
+		assert.Equal(t, int32(1), charges.Load())
+
+		// the completed invocations are replayed, the failed ones are
+		// called again
+		journal, err = NewJournal(store)
+		require.NoError(t, err)
+		assert.Empty(t, journal.Pending())
+
+		orderID, err := workflow(journal, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "order-1", orderID)
+		assert.Equal(t, int32(1), creates.Load())
+		assert.Equal(t, int32(2), charges.Load())
+
+		journal, err = NewJournal(store)
+		require.NoError(t, err)
+
+		_, err = workflow(journal, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), creates.Load())
+		assert.Equal(t, int32(2), charges.Load())
+
+		entries, err := store.Entries()
+		require.NoError(t, err)
+		require.Len(t, entries, 6)
+		assert.Equal(t, JournalEntry{Seq: 3, Type: JournalEntryStart, Name: "payment.charge", Key: "order-1", Time: entries[4].Time}, entries[4])
+		assert.JSONEq(t, `{"r1":42}`, string(entries[5].Results))
+	})
+
+	t.Run("Occurrences", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewMemoryJournalStore()
+
+		var calls atomic.Int32
+
+		next := func(journal *Journal) int {
+			n, err := InvokeWith(func() (int, error) {
+				return int(calls.Add(1)), nil
+			}, WithName("counter.next"), WithJournal(journal))
+			require.NoError(t, err)
+
+			return n
+		}
+
+		journal, err := NewJournal(store)
+		require.NoError(t, err)
+		assert.Equal(t, 1, next(journal))
+		assert.Equal(t, 2, next(journal))
+
+		journal, err = NewJournal(store)
+		require.NoError(t, err)
+		assert.Equal(t, 1, next(journal))
+		assert.Equal(t, 2, next(journal))
+		assert.Equal(t, 3, next(journal))
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("Abandoned", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewMemoryJournalStore()
+
+		var charges atomic.Int32
+
+		charge := func(journal *Journal) (int, error) {
+			return InvokeWith(func() (int, error) {
+				// ignores the context, and goes through late
+				time.Sleep(50 * time.Millisecond)
+				charges.Add(1)
+
+				return 42, nil
+			}, WithName("payment.charge"), WithJournal(journal), WithContextTimeout(10*time.Millisecond))
+		}
+
+		journal, err := NewJournal(store)
+		require.NoError(t, err)
+
+		_, err = charge(journal)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// still pending while the abandoned callback function is running
+		journal, err = NewJournal(store)
+		require.NoError(t, err)
+		assert.Len(t, journal.Pending(), 1)
+
+		require.Eventually(t, func() bool {
+			entries, err := store.Entries()
+			return err == nil && len(entries) == 2
+		}, time.Second, 5*time.Millisecond)
+
+		// the late success is replayed instead of charging again
+		journal, err = NewJournal(store)
+		require.NoError(t, err)
+		assert.Empty(t, journal.Pending())
+
+		res, err := charge(journal)
+		require.NoError(t, err)
+		assert.Equal(t, 42, res)
+		assert.Equal(t, int32(1), charges.Load())
+	})
+
+	t.Run("Unnamed", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewMemoryJournalStore()
+
+		journal, err := NewJournal(store)
+		require.NoError(t, err)
+
+		err = InvokeWith0(func() error {
+			return nil
+		}, WithJournal(journal))
+		require.NoError(t, err)
+
+		entries, err := store.Entries()
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("File", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "workflow.journal")
+
+		store, err := NewFileJournalStore(path)
+		require.NoError(t, err)
+
+		journal, err := NewJournal(store)
+		require.NoError(t, err)
+
+		var calls atomic.Int32
+
+		getUser := func() (string, int, error) {
+			calls.Add(1)
+			return "user-1", 1, nil
+		}
+
+		_, _, err = InvokeWith2(getUser, WithName("users.get"), WithJournal(journal))
+		require.NoError(t, err)
+		require.NoError(t, store.Close())
+
+		// simulate a crash after the start of an invocation and in the
+		// middle of appending an entry
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+		require.NoError(t, err)
+		_, err = file.WriteString(`{"seq":2,"type":"start","name":"users.update","time":"2026-01-01T00:00:00Z"}` + "\n" + `{"seq":2,"type":"comp`)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		store, err = NewFileJournalStore(path)
+		require.NoError(t, err)
+
+		defer store.Close()
+
+		journal, err = NewJournal(store)
+		require.NoError(t, err)
+
+		pending := journal.Pending()
+		require.Len(t, pending, 1)
+		assert.Equal(t, "users.update", pending[0].Name)
+
+		name, length, err := InvokeWith2(getUser, WithName("users.get"), WithJournal(journal))
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", name)
+		assert.Equal(t, 1, length)
+		assert.Equal(t, int32(1), calls.Load())
+
+		// the torn line is truncated, so that the new entries can be
+		// loaded after the next restart
+		err = InvokeWith0(func() error {
+			return nil
+		}, WithName("users.update"), WithJournal(journal))
+		require.NoError(t, err)
+
+		entries, err := store.Entries()
+		require.NoError(t, err)
+		require.Len(t, entries, 5)
+		assert.Equal(t, JournalEntryComplete, entries[4].Type)
+		assert.Equal(t, uint64(3), entries[4].Seq)
+	})
+
+	t.Run("Corrupted", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "workflow.journal")
+		require.NoError(t, os.WriteFile(path, []byte("{\n{}\n"), 0o600))
+
+		store, err := NewFileJournalStore(path)
+		require.NoError(t, err)
+
+		defer store.Close()
+
+		_, err = NewJournal(store)
+		require.ErrorContains(t, err, "journal: failed to decode line 1")
+	})
+}
@@ -0,0 +1,234 @@
+package fo
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	_ Invoker = (*keyedInvoker[string])(nil)
+)
+
+// keyedQueue is the queue of the calls sharing a key, the head of which
+// holds the key.
+type keyedQueue struct {
+	waiters []chan struct{}
+}
+
+// keyedTurn is the turn of a call holding the key, which is released once
+// both the invocation returned and none of the attempts of the callback
+// function is still running, so that an abandoned callback function never
+// interleaves with the next one. The attempts of the same call, e.g. the
+// retries, run one at a time as well.
+type keyedTurn struct {
+	mutex    sync.Mutex
+	running  bool
+	exited   chan struct{}
+	returned bool
+	release  func()
+}
+
+// enter waits for the attempt still running to exit, and counts the
+// attempt as running. It returns the error of ctx if ctx is done before,
+// or if the invocation has already returned.
+func (t *keyedTurn) enter(ctx context.Context) error {
+	for {
+		t.mutex.Lock()
+
+		if t.returned {
+			t.mutex.Unlock()
+			return contextError(ctx)
+		}
+		if !t.running {
+			t.running = true
+			t.exited = make(chan struct{})
+			t.mutex.Unlock()
+
+			return nil
+		}
+
+		exited := t.exited
+		t.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return contextError(ctx)
+		case <-exited:
+		}
+	}
+}
+
+func (t *keyedTurn) exit() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.running = false
+	close(t.exited)
+
+	if t.returned {
+		t.release()
+	}
+}
+
+func (t *keyedTurn) done() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.returned = true
+	if !t.running {
+		t.release()
+	}
+}
+
+// KeyedInvoker invokes the callback functions sharing a key one at a time
+// in the order they are called, while the ones with different keys run in
+// parallel, e.g. for the per-account operations that must not interleave.
+//
+// The calls waiting for their turns leave the queue once their contexts
+// are done, and the keys without any calls are removed so that idle keys
+// do not accumulate. The key is held until the callback function returns,
+// even if the caller has stopped waiting for it due to the timeout, so
+// that the next one never starts before the abandoned one finishes. The
+// retries of the same call wait for the abandoned attempts likewise.
+//
+//	accounts := fo.NewKeyedInvoker[string](fo.NewInvoker())
+//
+//	balance, err := fo.Do(ctx, accounts.For(accountID), func(ctx context.Context) (int64, error) {
+//		return withdraw(ctx, accountID, amount)
+//	}, fo.WithContextTimeout(time.Second))
+type KeyedInvoker[K comparable] struct {
+	invoker Invoker
+
+	mutex  sync.Mutex
+	queues map[K]*keyedQueue
+}
+
+// NewKeyedInvoker creates a new KeyedInvoker that invokes the callback
+// functions with the invoker, which is usually NewInvoker().
+func NewKeyedInvoker[K comparable](invoker Invoker) *KeyedInvoker[K] {
+	return &KeyedInvoker[K]{
+		invoker: invoker,
+		queues:  make(map[K]*keyedQueue),
+	}
+}
+
+// Do waits for the turn of the key, and invokes fn with the call options
+// applied. The error of ctx is returned if ctx is done before the turn.
+func (k *KeyedInvoker[K]) Do(ctx context.Context, key K, fn func(ctx context.Context) (any, error), opts ...CallInvokeWithOption) (any, error) {
+	release, err := k.acquire(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	turn := &keyedTurn{release: release}
+	defer turn.done()
+
+	return k.invoker.Do(ctx, func(ctx context.Context) (any, error) {
+		err := turn.enter(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		defer turn.exit()
+
+		return fn(ctx)
+	}, opts...)
+}
+
+// For returns an Invoker that invokes the callback functions with the
+// key, which can be used with Do(...) and Do0(...) for typed results.
+func (k *KeyedInvoker[K]) For(key K) Invoker {
+	return &keyedInvoker[K]{
+		keyed: k,
+		key:   key,
+	}
+}
+
+// acquire waits for the turn of the key, and returns the function to
+// release the key.
+func (k *KeyedInvoker[K]) acquire(ctx context.Context, key K) (func(), error) {
+	turn := make(chan struct{})
+
+	k.mutex.Lock()
+
+	queue, ok := k.queues[key]
+	if !ok {
+		queue = &keyedQueue{waiters: make([]chan struct{}, 0, 1)}
+		k.queues[key] = queue
+	}
+
+	queue.waiters = append(queue.waiters, turn)
+	if len(queue.waiters) == 1 {
+		close(turn)
+	}
+
+	k.mutex.Unlock()
+
+	release := func() {
+		k.release(key, queue)
+	}
+
+	select {
+	case <-turn:
+		return release, nil
+	case <-ctx.Done():
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	select {
+	case <-turn:
+		// the turn came at the same time, hand it over to the next one
+		k.releaseLocked(key, queue)
+	default:
+		k.leaveLocked(key, queue, turn)
+	}
+
+	return nil, contextError(ctx)
+}
+
+func (k *KeyedInvoker[K]) release(key K, queue *keyedQueue) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.releaseLocked(key, queue)
+}
+
+// releaseLocked removes the head of the queue and hands the key over to
+// the next one, must be called with the mutex held.
+func (k *KeyedInvoker[K]) releaseLocked(key K, queue *keyedQueue) {
+	queue.waiters = queue.waiters[1:]
+	if len(queue.waiters) == 0 {
+		delete(k.queues, key)
+		return
+	}
+
+	close(queue.waiters[0])
+}
+
+// leaveLocked removes the waiting turn from the queue, must be called
+// with the mutex held.
+func (k *KeyedInvoker[K]) leaveLocked(key K, queue *keyedQueue, turn chan struct{}) {
+	for i, waiter := range queue.waiters {
+		if waiter == turn {
+			queue.waiters = append(queue.waiters[:i], queue.waiters[i+1:]...)
+			break
+		}
+	}
+
+	if len(queue.waiters) == 0 {
+		delete(k.queues, key)
+	}
+}
+
+// keyedInvoker is the Invoker returned by KeyedInvoker.For(...).
+type keyedInvoker[K comparable] struct {
+	keyed *KeyedInvoker[K]
+	key   K
+}
+
+// Do invokes fn with the key.
+func (i *keyedInvoker[K]) Do(ctx context.Context, fn func(ctx context.Context) (any, error), opts ...CallInvokeWithOption) (any, error) {
+	return i.keyed.Do(ctx, i.key, fn, opts...)
+}
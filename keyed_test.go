@@ -0,0 +1,247 @@
+package fo
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (k *KeyedInvoker[K]) keys() int {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return len(k.queues)
+}
+
+func (k *KeyedInvoker[K]) waiters(key K) int {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	queue, ok := k.queues[key]
+	if !ok {
+		return 0
+	}
+
+	return len(queue.waiters)
+}
+
+func TestKeyedInvoker(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Serialized", func(t *testing.T) {
+		t.Parallel()
+
+		keyed := NewKeyedInvoker[string](NewInvoker())
+
+		var mutex sync.Mutex
+		var running atomic.Int32
+
+		order := make([]int, 0)
+		release := make(chan struct{})
+
+		var wg sync.WaitGroup
+
+		for i := range 10 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				err := Do0(context.Background(), keyed.For("account-1"), func(context.Context) error {
+					assert.Equal(t, int32(1), running.Add(1))
+					defer running.Add(-1)
+
+					<-release
+
+					mutex.Lock()
+					order = append(order, i)
+					mutex.Unlock()
+
+					return nil
+				})
+				assert.NoError(t, err)
+			}()
+
+			// makes sure the calls are queued in order
+			for keyed.waiters("account-1") < i+1 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, order)
+		assert.Zero(t, keyed.keys())
+	})
+
+	t.Run("Parallel", func(t *testing.T) {
+		t.Parallel()
+
+		keyed := NewKeyedInvoker[int](NewInvoker())
+
+		var running, maxRunning atomic.Int32
+
+		var wg sync.WaitGroup
+
+		for i := range 5 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				res, err := Do(context.Background(), keyed.For(i), func(context.Context) (int, error) {
+					n := running.Add(1)
+					defer running.Add(-1)
+
+					for {
+						current := maxRunning.Load()
+						if n <= current || maxRunning.CompareAndSwap(current, n) {
+							break
+						}
+					}
+
+					time.Sleep(20 * time.Millisecond)
+
+					return i * 10, nil
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, i*10, res)
+			}()
+		}
+
+		wg.Wait()
+
+		assert.Greater(t, maxRunning.Load(), int32(1))
+		assert.Zero(t, keyed.keys())
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		t.Parallel()
+
+		keyed := NewKeyedInvoker[string](NewInvoker())
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		go func() {
+			_, _ = keyed.Do(context.Background(), "account-1", func(context.Context) (any, error) {
+				close(started)
+				<-release
+
+				return nil, nil
+			})
+		}()
+
+		<-started
+
+		var calls atomic.Int32
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := keyed.Do(ctx, "account-1", func(context.Context) (any, error) {
+			calls.Add(1)
+			return nil, nil
+		})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		close(release)
+
+		res, err := keyed.Do(context.Background(), "account-1", func(context.Context) (any, error) {
+			return "ok", nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "ok", res)
+		assert.Zero(t, calls.Load())
+		assert.Zero(t, keyed.keys())
+	})
+
+	t.Run("Abandoned", func(t *testing.T) {
+		t.Parallel()
+
+		keyed := NewKeyedInvoker[string](NewInvoker())
+
+		var running atomic.Int32
+
+		_, err := keyed.Do(context.Background(), "account-1", func(context.Context) (any, error) {
+			running.Add(1)
+			defer running.Add(-1)
+
+			time.Sleep(50 * time.Millisecond)
+
+			return nil, nil
+		}, WithContextTimeout(10*time.Millisecond))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// the next call waits for the abandoned callback function
+		_, err = keyed.Do(context.Background(), "account-1", func(context.Context) (any, error) {
+			assert.Zero(t, running.Load())
+			return nil, nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("Retries", func(t *testing.T) {
+		t.Parallel()
+
+		registry := NewRegistry()
+		registry.Set("test.keyed.retries", Policy{
+			Timeout: Duration(10 * time.Millisecond),
+			Retries: 2,
+		})
+
+		keyed := NewKeyedInvoker[string](NewInvoker())
+
+		var calls, running, maxRunning atomic.Int32
+
+		_, err := keyed.Do(context.Background(), "account-1", func(context.Context) (any, error) {
+			calls.Add(1)
+
+			current := running.Add(1)
+			defer running.Add(-1)
+
+			for {
+				peak := maxRunning.Load()
+				if current <= peak || maxRunning.CompareAndSwap(peak, current) {
+					break
+				}
+			}
+
+			time.Sleep(50 * time.Millisecond)
+
+			return nil, nil
+		}, WithName("test.keyed.retries"), WithRegistry(registry))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// the retries wait for the abandoned attempt instead of overlapping
+		// with it, and give up once they time out
+		_, err = keyed.Do(context.Background(), "account-1", func(context.Context) (any, error) {
+			return nil, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), calls.Load())
+		assert.Equal(t, int32(1), maxRunning.Load())
+	})
+
+	t.Run("Not called", func(t *testing.T) {
+		t.Parallel()
+
+		keyed := NewKeyedInvoker[string](NewMockInvoker().On("test.keyed.stubbed", "stubbed", nil))
+
+		for range 2 {
+			res, err := keyed.Do(context.Background(), "account-1", func(context.Context) (any, error) {
+				return nil, assert.AnError
+			}, WithName("test.keyed.stubbed"))
+			require.NoError(t, err)
+			assert.Equal(t, "stubbed", res)
+		}
+
+		assert.Zero(t, keyed.keys())
+	})
+}
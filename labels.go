@@ -0,0 +1,55 @@
+package fo
+
+import (
+	"runtime/pprof"
+	"sync/atomic"
+)
+
+const (
+	// LabelName is the pprof label key of the invocation name set by
+	// WithName(...).
+	LabelName = "fo.name"
+	// LabelCaller is the pprof label key of the call site of the
+	// invocation, formatted as "<function>:<line>".
+	LabelCaller = "fo.caller"
+)
+
+const (
+	defaultTraceName = "fo.invoke"
+)
+
+var (
+	profilingLabels atomic.Bool
+)
+
+// SetProfilingLabels enables or disables the pprof labels of the callback
+// goroutines of all the invocations. It is disabled by default, since
+// labeling the goroutine and resolving the call site cost every
+// invocation, the invocations with WithLabels(...) are labeled anyway.
+func SetProfilingLabels(enabled bool) {
+	profilingLabels.Store(enabled)
+}
+
+// pprofLabels returns the pprof labels for the callback goroutine, the
+// user-supplied labels come after the built-in ones and override them on
+// conflicts.
+func (c *invocation) pprofLabels() pprof.LabelSet {
+	args := make([]string, 0, 4+len(c.labels))
+	if c.name != "" {
+		args = append(args, LabelName, c.name)
+	}
+
+	args = append(args, LabelCaller, c.caller)
+	args = append(args, c.labels...)
+
+	return pprof.Labels(args...)
+}
+
+// traceName returns the name of the runtime/trace task and region.
+func (c *invocation) traceName() string {
+	if c.name == "" {
+		return defaultTraceName
+	}
+
+	return c.name
+}
@@ -0,0 +1,84 @@
+package fo
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"runtime/pprof"
+	"runtime/trace"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvocationPprofLabels(t *testing.T) {
+	t.Parallel()
+
+	call := &invocation{name: "payments.charge", caller: "main.main:1", labels: []string{"tenant", "acme"}}
+
+	ctx := pprof.WithLabels(context.Background(), call.pprofLabels())
+
+	name, ok := pprof.Label(ctx, LabelName)
+	require.True(t, ok)
+	assert.Equal(t, "payments.charge", name)
+
+	caller, ok := pprof.Label(ctx, LabelCaller)
+	require.True(t, ok)
+	assert.Equal(t, "main.main:1", caller)
+
+	tenant, ok := pprof.Label(ctx, "tenant")
+	require.True(t, ok)
+	assert.Equal(t, "acme", tenant)
+
+	assert.Equal(t, "payments.charge", call.traceName())
+	assert.Equal(t, defaultTraceName, (&invocation{}).traceName())
+}
+
+func TestInvokeWithLabels(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		_ = InvokeWith0(func() error {
+			close(started)
+			<-release
+
+			return nil
+		}, WithName("test.labels"), WithLabels("tenant", "acme"))
+	}()
+
+	<-started
+
+	buffer := new(bytes.Buffer)
+	require.NoError(t, pprof.Lookup("goroutine").WriteTo(buffer, 1))
+	close(release)
+
+	assert.Contains(t, buffer.String(), `"fo.name":"test.labels"`)
+	assert.Contains(t, buffer.String(), `"tenant":"acme"`)
+	assert.Contains(t, buffer.String(), `"fo.caller":"github.com/nekomeowww/fo.TestInvokeWithLabels.func1:`)
+
+	assert.Panics(t, func() {
+		_ = WithLabels("tenant")
+	})
+}
+
+func TestInvokeWithTracing(t *testing.T) {
+	require.NoError(t, trace.Start(io.Discard))
+	defer trace.Stop()
+
+	res, err := InvokeWith(func() (string, error) {
+		return "foo", nil
+	}, WithName("test.trace"))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", res)
+
+	_, err = InvokeWith(func() (string, error) {
+		time.Sleep(time.Second)
+		return "foo", nil
+	}, WithName("test.trace"), WithContextTimeout(time.Millisecond))
+	require.Error(t, err)
+}
@@ -218,6 +218,8 @@ func (h *mayHandlers) handleError(anyErr any, messageArgs ...any) {
 		return
 	}
 
+	exportMaySpan(err, messageArgs...)
+
 	for _, handler := range h.handlers {
 		if handler != nil {
 			handler(err, messageArgs...)
@@ -227,3 +229,19 @@ func (h *mayHandlers) handleError(anyErr any, messageArgs ...any) {
 	err = formatErrorWithMessageArgs(err, messageArgs...)
 	h.errs = multierr.Append(h.errs, err)
 }
+
+// callHandlers calls the registered handlers with the error without
+// collecting it, for the long-running callers like Supervisor which would
+// otherwise collect the errors endlessly.
+func (h *mayHandlers) callHandlers(err error, messageArgs ...any) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	exportMaySpan(err, messageArgs...)
+
+	for _, handler := range h.handlers {
+		if handler != nil {
+			handler(err, messageArgs...)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package fo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// OutcomeOK is the outcome of invocations returned without error.
+	OutcomeOK = "ok"
+	// OutcomeError is the outcome of invocations returned with error.
+	OutcomeError = "error"
+	// OutcomeTimeout is the outcome of invocations whose context is done
+	// before the callback function returns.
+	OutcomeTimeout = "timeout"
+	// OutcomePanic is the outcome of invocations whose callback function
+	// panicked.
+	OutcomePanic = "panic"
+)
+
+const (
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+type invocationOutcomeKey struct {
+	name    string
+	outcome string
+}
+
+// Metrics is an Observer that collects the metrics of invocations and
+// serves them in the Prometheus text exposition format as an
+// http.Handler, without depending on the Prometheus client library.
+//
+// The following metrics are exposed:
+//
+//   - fo_invocations_total{name,outcome}: counter of invocations by name
+//     and outcome (ok, error, timeout, panic).
+//   - fo_invocation_duration_seconds{name}: histogram of the latency of
+//     invocations by name.
+//   - fo_invocations_in_flight: gauge of the running callback goroutines.
+//   - fo_invocations_abandoned: gauge of the running callback goroutines
+//     whose callers have already left.
+//   - fo_may_errors_total{message}: counter of the errors handled by the
+//     MayHandler returned by MayHandler(), by message.
+//
+// Register it with SetObservers(...) or WithObservers(...), and mount it
+// to the HTTP server:
+//
+//	metrics := fo.NewMetrics()
+//	fo.SetObservers(metrics)
+//	fo.SetHandlers(metrics.MayHandler())
+//	http.Handle("/metrics", metrics)
+type Metrics struct {
+	latency *LatencyHistogram
+
+	mutex       sync.Mutex
+	invocations map[invocationOutcomeKey]uint64
+	mayErrors   map[string]uint64
+}
+
+var (
+	_ Observer     = (*Metrics)(nil)
+	_ http.Handler = (*Metrics)(nil)
+)
+
+// NewMetrics creates a new Metrics with the given latency histogram
+// bucket upper bounds, DefaultLatencyBuckets is used if none is given.
+func NewMetrics(buckets ...time.Duration) *Metrics {
+	return &Metrics{
+		latency:     NewLatencyHistogram(buckets...),
+		invocations: make(map[invocationOutcomeKey]uint64),
+		mayErrors:   make(map[string]uint64),
+	}
+}
+
+// OnStart implements Observer.
+func (m *Metrics) OnStart(InvocationEvent) {}
+
+// OnFinish implements Observer.
+func (m *Metrics) OnFinish(event InvocationEvent) {
+	if event.Err != nil {
+		m.observe(event, OutcomeError)
+		return
+	}
+
+	m.observe(event, OutcomeOK)
+}
+
+// OnTimeout implements Observer.
+func (m *Metrics) OnTimeout(event InvocationEvent) {
+	m.observe(event, OutcomeTimeout)
+}
+
+// OnPanic implements Observer.
+func (m *Metrics) OnPanic(event InvocationEvent) {
+	m.observe(event, OutcomePanic)
+}
+
+func (m *Metrics) observe(event InvocationEvent, outcome string) {
+	m.latency.Observe(event.Name, event.Duration)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.invocations[invocationOutcomeKey{name: event.Name, outcome: outcome}]++
+}
+
+// MayHandler returns a MayHandler that counts the errors handled by May
+// and May* functions by their messages. The messages are labeled with the
+// format strings instead of the formatted ones, so that the arguments like
+// IDs don't blow up the cardinality of the label.
+func (m *Metrics) MayHandler() MayHandler {
+	return func(err error, messageArgs ...any) {
+		message := mayMessageLabel(messageArgs...)
+
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		m.mayErrors[message]++
+	}
+}
+
+// mayMessageLabel returns the format string of the message arguments, or
+// the type of the first argument if it is not a string.
+func mayMessageLabel(messageArgs ...any) string {
+	if len(messageArgs) == 0 {
+		return ""
+	}
+
+	message, ok := messageArgs[0].(string)
+	if !ok {
+		return fmt.Sprintf("%T", messageArgs[0])
+	}
+
+	return message
+}
+
+// ServeHTTP implements http.Handler.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", metricsContentType)
+
+	_ = m.WriteText(w)
+}
+
+// WriteText writes the metrics to w in the Prometheus text exposition
+// format.
+func (m *Metrics) WriteText(writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+
+	m.mutex.Lock()
+
+	invocations := make(map[invocationOutcomeKey]uint64, len(m.invocations))
+	for key, count := range m.invocations {
+		invocations[key] = count
+	}
+
+	mayErrors := make(map[string]uint64, len(m.mayErrors))
+	for message, count := range m.mayErrors {
+		mayErrors[message] = count
+	}
+
+	m.mutex.Unlock()
+
+	writeMetricHeader(w, "fo_invocations_total", "counter", "Total number of invocations by name and outcome.")
+
+	keys := make([]invocationOutcomeKey, 0, len(invocations))
+	for key := range invocations {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+
+		return keys[i].outcome < keys[j].outcome
+	})
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "fo_invocations_total{name=%s,outcome=%s} %d\n", quoteLabelValue(key.name), quoteLabelValue(key.outcome), invocations[key])
+	}
+
+	writeMetricHeader(w, "fo_invocation_duration_seconds", "histogram", "Latency of invocations by name in seconds.")
+
+	snapshots := m.latency.Snapshots()
+
+	names := make([]string, 0, len(snapshots))
+	for name := range snapshots {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		writeHistogram(w, "fo_invocation_duration_seconds", name, snapshots[name])
+	}
+
+	writeMetricHeader(w, "fo_invocations_in_flight", "gauge", "Number of running callback goroutines, including the abandoned ones.")
+	fmt.Fprintf(w, "fo_invocations_in_flight %d\n", InFlightInvocations())
+
+	writeMetricHeader(w, "fo_invocations_abandoned", "gauge", "Number of running callback goroutines whose callers have already left.")
+	fmt.Fprintf(w, "fo_invocations_abandoned %d\n", AbandonedInvocations())
+
+	writeMetricHeader(w, "fo_may_errors_total", "counter", "Total number of errors handled by May handlers by message.")
+
+	messages := make([]string, 0, len(mayErrors))
+	for message := range mayErrors {
+		messages = append(messages, message)
+	}
+
+	sort.Strings(messages)
+
+	for _, message := range messages {
+		fmt.Fprintf(w, "fo_may_errors_total{message=%s} %d\n", quoteLabelValue(message), mayErrors[message])
+	}
+
+	return w.Flush()
+}
+
+func writeMetricHeader(w *bufio.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+func writeHistogram(w *bufio.Writer, metricName, name string, snapshot HistogramSnapshot) {
+	nameLabel := quoteLabelValue(name)
+
+	var cumulative uint64
+
+	for i, bucket := range snapshot.Buckets {
+		cumulative += snapshot.Counts[i]
+		fmt.Fprintf(w, "%s_bucket{name=%s,le=\"%s\"} %d\n", metricName, nameLabel, formatSeconds(bucket), cumulative)
+	}
+
+	fmt.Fprintf(w, "%s_bucket{name=%s,le=\"+Inf\"} %d\n", metricName, nameLabel, snapshot.Count)
+	fmt.Fprintf(w, "%s_sum{name=%s} %s\n", metricName, nameLabel, formatSeconds(snapshot.Sum))
+	fmt.Fprintf(w, "%s_count{name=%s} %d\n", metricName, nameLabel, snapshot.Count)
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+// quoteLabelValue quotes the label value with the escaping rules of the
+// Prometheus text exposition format.
+func quoteLabelValue(value string) string {
+	var sb strings.Builder
+
+	sb.Grow(len(value) + 2)
+	sb.WriteByte('"')
+
+	for _, r := range value {
+		switch r {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '"':
+			sb.WriteString(`\"`)
+		case '\n':
+			sb.WriteString(`\n`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	sb.WriteByte('"')
+
+	return sb.String()
+}
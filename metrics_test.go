@@ -0,0 +1,81 @@
+package fo
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := NewMetrics(10*time.Millisecond, 100*time.Millisecond)
+
+	metrics.OnFinish(InvocationEvent{Name: "payments.charge", Duration: 5 * time.Millisecond})
+	metrics.OnFinish(InvocationEvent{Name: "payments.charge", Duration: 50 * time.Millisecond, Err: assert.AnError})
+	metrics.OnTimeout(InvocationEvent{Name: "payments.charge", Duration: time.Second})
+	metrics.OnPanic(InvocationEvent{Name: `weird "name"`, Duration: time.Millisecond})
+
+	may := NewMay0().Use(metrics.MayHandler())
+	may.Invoke(errors.New("failed"), "failed to charge %s", "order-1")
+	may.Invoke(errors.New("failed"), "failed to charge %s", "order-2")
+	may.Invoke(errors.New("failed"), 42)
+	may.Invoke(errors.New("failed"))
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", recorder.Header().Get("Content-Type"))
+
+	body := recorder.Body.String()
+
+	for _, line := range []string{
+		"# TYPE fo_invocations_total counter",
+		`fo_invocations_total{name="payments.charge",outcome="error"} 1`,
+		`fo_invocations_total{name="payments.charge",outcome="ok"} 1`,
+		`fo_invocations_total{name="payments.charge",outcome="timeout"} 1`,
+		`fo_invocations_total{name="weird \"name\"",outcome="panic"} 1`,
+		"# TYPE fo_invocation_duration_seconds histogram",
+		`fo_invocation_duration_seconds_bucket{name="payments.charge",le="0.01"} 1`,
+		`fo_invocation_duration_seconds_bucket{name="payments.charge",le="0.1"} 2`,
+		`fo_invocation_duration_seconds_bucket{name="payments.charge",le="+Inf"} 3`,
+		`fo_invocation_duration_seconds_sum{name="payments.charge"} 1.055`,
+		`fo_invocation_duration_seconds_count{name="payments.charge"} 3`,
+		"# TYPE fo_invocations_in_flight gauge",
+		"# TYPE fo_invocations_abandoned gauge",
+		"# TYPE fo_may_errors_total counter",
+		`fo_may_errors_total{message="failed to charge %s"} 2`,
+		`fo_may_errors_total{message="int"} 1`,
+		`fo_may_errors_total{message=""} 1`,
+	} {
+		assert.Contains(t, strings.Split(body, "\n"), line)
+	}
+}
+
+func TestMetricsObserveInvocations(t *testing.T) {
+	t.Parallel()
+
+	metrics := NewMetrics()
+
+	err := InvokeWith0(func() error {
+		return nil
+	}, WithName("test.metrics"), WithObservers(metrics))
+	require.NoError(t, err)
+
+	sb := new(strings.Builder)
+	require.NoError(t, metrics.WriteText(sb))
+	assert.Contains(t, sb.String(), `fo_invocations_total{name="test.metrics",outcome="ok"} 1`)
+}
+
+func TestQuoteLabelValue(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, `"foo"`, quoteLabelValue("foo"))
+	assert.Equal(t, `"a\\b\"c\nd"`, quoteLabelValue("a\\b\"c\nd"))
+}
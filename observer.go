@@ -0,0 +1,373 @@
+package fo
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	observersMutex  = sync.RWMutex{}
+	globalObservers = make([]Observer, 0)
+)
+
+// SetObservers sets the global observers that observe every invocation
+// made by Invoke*, InvokeWith* and InvokeWithTimeout*.
+//
+// NOTICE: This function will replace all the global existing observers
+// on package fo level.
+func SetObservers(observer ...Observer) {
+	observersMutex.Lock()
+	defer observersMutex.Unlock()
+
+	globalObservers = make([]Observer, 0, len(observer))
+	globalObservers = append(globalObservers, observer...)
+}
+
+func currentObservers() []Observer {
+	observersMutex.RLock()
+	defer observersMutex.RUnlock()
+
+	return globalObservers
+}
+
+// InvocationEvent describes an event of an invocation.
+type InvocationEvent struct {
+	// Name is the name set by WithName(...), empty for unnamed
+	// invocations.
+	Name string
+	// Caller is the call site of the invocation, formatted as
+	// "<function>:<line>".
+	Caller string
+	// Start is the time the invocation started.
+	Start time.Time
+	// Duration is the time elapsed since Start, zero for OnStart.
+	Duration time.Duration
+	// Err is the error returned by the callback function for OnFinish,
+	// ctx.Err() for OnTimeout, and the *PanicError for OnPanic.
+	Err error
+	// Attempt is the attempt number of the invocation starting from 1,
+	// it increases when the invocation is retried by its policy.
+	Attempt int
+}
+
+// Observer observes the events of invocations. Register it globally with
+// SetObservers(...), or per call with WithObservers(...).
+//
+// OnStart is called before the callback function is called, and exactly
+// one of OnFinish, OnTimeout and OnPanic is called after it when the
+// caller returns. OnPanic may also be called after OnTimeout if the
+// callback function panics after the caller has left.
+//
+// The methods are called synchronously, implementations should be safe
+// for concurrent use and return quickly.
+type Observer interface {
+	OnStart(event InvocationEvent)
+	OnFinish(event InvocationEvent)
+	OnTimeout(event InvocationEvent)
+	OnPanic(event InvocationEvent)
+}
+
+var (
+	_ Observer = ObserverFuncs{}
+	_ Observer = (*LatencyHistogram)(nil)
+	_ Observer = (*SlowCallDetector)(nil)
+)
+
+// ObserverFuncs is an adapter to use functions as Observer, nil
+// functions are ignored.
+type ObserverFuncs struct {
+	OnStartFunc   func(event InvocationEvent)
+	OnFinishFunc  func(event InvocationEvent)
+	OnTimeoutFunc func(event InvocationEvent)
+	OnPanicFunc   func(event InvocationEvent)
+}
+
+// OnStart implements Observer.
+func (o ObserverFuncs) OnStart(event InvocationEvent) {
+	if o.OnStartFunc != nil {
+		o.OnStartFunc(event)
+	}
+}
+
+// OnFinish implements Observer.
+func (o ObserverFuncs) OnFinish(event InvocationEvent) {
+	if o.OnFinishFunc != nil {
+		o.OnFinishFunc(event)
+	}
+}
+
+// OnTimeout implements Observer.
+func (o ObserverFuncs) OnTimeout(event InvocationEvent) {
+	if o.OnTimeoutFunc != nil {
+		o.OnTimeoutFunc(event)
+	}
+}
+
+// OnPanic implements Observer.
+func (o ObserverFuncs) OnPanic(event InvocationEvent) {
+	if o.OnPanicFunc != nil {
+		o.OnPanicFunc(event)
+	}
+}
+
+// DefaultLatencyBuckets are the default upper bounds of the buckets of
+// LatencyHistogram.
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// HistogramSnapshot is a point-in-time copy of the latency histogram of
+// an invocation name.
+type HistogramSnapshot struct {
+	// Buckets are the upper bounds of the buckets in ascending order.
+	Buckets []time.Duration
+	// Counts are the non-cumulative counts of each bucket, it has one
+	// more element than Buckets for the observations greater than the
+	// last bucket.
+	Counts []uint64
+	// Count is the total number of observations.
+	Count uint64
+	// Sum is the sum of all the observations.
+	Sum time.Duration
+}
+
+// Quantile estimates the q-quantile (0 <= q <= 1) of the observations by
+// linear interpolation within the bucket the quantile falls into. The
+// upper bound of the last bucket is returned for the quantiles that fall
+// into the overflow bucket.
+func (s HistogramSnapshot) Quantile(q float64) time.Duration {
+	if s.Count == 0 || len(s.Buckets) == 0 {
+		return 0
+	}
+
+	rank := q * float64(s.Count)
+
+	var cumulative uint64
+
+	for i, count := range s.Counts {
+		if count == 0 || float64(cumulative+count) < rank {
+			cumulative += count
+			continue
+		}
+		if i >= len(s.Buckets) {
+			break
+		}
+
+		var lower time.Duration
+		if i > 0 {
+			lower = s.Buckets[i-1]
+		}
+
+		fraction := (rank - float64(cumulative)) / float64(count)
+
+		return lower + time.Duration(fraction*float64(s.Buckets[i]-lower))
+	}
+
+	return s.Buckets[len(s.Buckets)-1]
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    time.Duration
+}
+
+// LatencyHistogram is an Observer that records the latency of finished,
+// timed out and panicked invocations into in-memory histograms per
+// invocation name.
+type LatencyHistogram struct {
+	buckets []time.Duration
+
+	mutex      sync.Mutex
+	histograms map[string]*histogram
+}
+
+// NewLatencyHistogram creates a new LatencyHistogram with the given
+// bucket upper bounds, DefaultLatencyBuckets is used if none is given.
+func NewLatencyHistogram(buckets ...time.Duration) *LatencyHistogram {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+
+	sorted := make([]time.Duration, len(buckets))
+	copy(sorted, buckets)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	return &LatencyHistogram{
+		buckets:    sorted,
+		histograms: make(map[string]*histogram),
+	}
+}
+
+// Observe records the duration for the invocation name.
+func (h *LatencyHistogram) Observe(name string, duration time.Duration) {
+	index := sort.Search(len(h.buckets), func(i int) bool {
+		return duration <= h.buckets[i]
+	})
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	hist, ok := h.histograms[name]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.histograms[name] = hist
+	}
+
+	hist.counts[index]++
+	hist.count++
+	hist.sum += duration
+}
+
+// Snapshot returns the snapshot of the histogram of the invocation name.
+func (h *LatencyHistogram) Snapshot(name string) HistogramSnapshot {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	snapshot := HistogramSnapshot{
+		Buckets: h.buckets,
+		Counts:  make([]uint64, len(h.buckets)+1),
+	}
+
+	hist, ok := h.histograms[name]
+	if !ok {
+		return snapshot
+	}
+
+	copy(snapshot.Counts, hist.counts)
+	snapshot.Count = hist.count
+	snapshot.Sum = hist.sum
+
+	return snapshot
+}
+
+// Snapshots returns the snapshots of the histograms of all the observed
+// invocation names.
+func (h *LatencyHistogram) Snapshots() map[string]HistogramSnapshot {
+	h.mutex.Lock()
+	names := make([]string, 0, len(h.histograms))
+
+	for name := range h.histograms {
+		names = append(names, name)
+	}
+	h.mutex.Unlock()
+
+	snapshots := make(map[string]HistogramSnapshot, len(names))
+	for _, name := range names {
+		snapshots[name] = h.Snapshot(name)
+	}
+
+	return snapshots
+}
+
+// OnStart implements Observer.
+func (h *LatencyHistogram) OnStart(InvocationEvent) {}
+
+// OnFinish implements Observer.
+func (h *LatencyHistogram) OnFinish(event InvocationEvent) {
+	h.Observe(event.Name, event.Duration)
+}
+
+// OnTimeout implements Observer.
+func (h *LatencyHistogram) OnTimeout(event InvocationEvent) {
+	h.Observe(event.Name, event.Duration)
+}
+
+// OnPanic implements Observer.
+func (h *LatencyHistogram) OnPanic(event InvocationEvent) {
+	h.Observe(event.Name, event.Duration)
+}
+
+// SlowCallDetector is an Observer that calls the callback for the
+// invocations that took at least the threshold to finish, time out or
+// panic.
+type SlowCallDetector struct {
+	threshold time.Duration
+	callback  func(event InvocationEvent)
+}
+
+// NewSlowCallDetector creates a new SlowCallDetector.
+func NewSlowCallDetector(threshold time.Duration, callback func(event InvocationEvent)) *SlowCallDetector {
+	return &SlowCallDetector{
+		threshold: threshold,
+		callback:  callback,
+	}
+}
+
+// OnStart implements Observer.
+func (d *SlowCallDetector) OnStart(InvocationEvent) {}
+
+// OnFinish implements Observer.
+func (d *SlowCallDetector) OnFinish(event InvocationEvent) {
+	d.detect(event)
+}
+
+// OnTimeout implements Observer.
+func (d *SlowCallDetector) OnTimeout(event InvocationEvent) {
+	d.detect(event)
+}
+
+// OnPanic implements Observer.
+func (d *SlowCallDetector) OnPanic(event InvocationEvent) {
+	d.detect(event)
+}
+
+func (d *SlowCallDetector) detect(event InvocationEvent) {
+	if event.Duration >= d.threshold {
+		d.callback(event)
+	}
+}
+
+type invocationEventKind int
+
+const (
+	invocationEventKindStart invocationEventKind = iota
+	invocationEventKindFinish
+	invocationEventKindTimeout
+	invocationEventKindPanic
+)
+
+// notify notifies the observers of the invocation with the event.
+func (c *invocation) notify(kind invocationEventKind, start time.Time, err error) {
+	if len(c.observers) == 0 {
+		return
+	}
+
+	event := InvocationEvent{
+		Name:    c.name,
+		Caller:  c.caller,
+		Start:   start,
+		Err:     err,
+		Attempt: c.attempt,
+	}
+	if kind != invocationEventKindStart {
+		event.Duration = time.Since(start)
+	}
+
+	for _, observer := range c.observers {
+		switch kind {
+		case invocationEventKindStart:
+			observer.OnStart(event)
+		case invocationEventKindFinish:
+			observer.OnFinish(event)
+		case invocationEventKindTimeout:
+			observer.OnTimeout(event)
+		case invocationEventKindPanic:
+			observer.OnPanic(event)
+		}
+	}
+}
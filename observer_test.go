@@ -0,0 +1,203 @@
+package fo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// observedEvent is an event observed by the observer of
+// recordingObserver(...) with its kind.
+type observedEvent struct {
+	kind  string
+	event InvocationEvent
+}
+
+func recordingObserver(recorder *testRecorder[observedEvent]) Observer {
+	record := func(kind string) func(event InvocationEvent) {
+		return func(event InvocationEvent) {
+			recorder.record(observedEvent{kind: kind, event: event})
+		}
+	}
+
+	return ObserverFuncs{
+		OnStartFunc:   record("start"),
+		OnFinishFunc:  record("finish"),
+		OnTimeoutFunc: record("timeout"),
+		OnPanicFunc:   record("panic"),
+	}
+}
+
+// observedKinds returns the kinds of the observed events, and the last
+// observed event.
+func observedKinds(recorder *testRecorder[observedEvent]) ([]string, InvocationEvent) {
+	var last InvocationEvent
+
+	events := recorder.snapshot()
+	kinds := make([]string, 0, len(events))
+
+	for _, observed := range events {
+		kinds = append(kinds, observed.kind)
+		last = observed.event
+	}
+
+	return kinds, last
+}
+
+func TestObserver(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Finish", func(t *testing.T) {
+		t.Parallel()
+
+		recorder := &testRecorder[observedEvent]{}
+
+		err := InvokeWith0(func() error {
+			return assert.AnError
+		}, WithName("test.finish"), WithObservers(recordingObserver(recorder)))
+		require.Error(t, err)
+
+		events, last := observedKinds(recorder)
+		assert.Equal(t, []string{"start", "finish"}, events)
+		assert.Equal(t, "test.finish", last.Name)
+		assert.Contains(t, last.Caller, "fo.TestObserver.func1:")
+		assert.Equal(t, assert.AnError, last.Err)
+		assert.Equal(t, 1, last.Attempt)
+		assert.False(t, last.Start.IsZero())
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		t.Parallel()
+
+		recorder := &testRecorder[observedEvent]{}
+
+		err := InvokeWith0(func() error {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		}, WithContextTimeout(10*time.Millisecond), WithObservers(recordingObserver(recorder)))
+		require.Error(t, err)
+
+		events, last := observedKinds(recorder)
+		assert.Equal(t, []string{"start", "timeout"}, events)
+		assert.ErrorIs(t, last.Err, context.DeadlineExceeded)
+		assert.GreaterOrEqual(t, last.Duration, 10*time.Millisecond)
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		t.Parallel()
+
+		recorder := &testRecorder[observedEvent]{}
+
+		err := callWithPanicRecovery(func() error {
+			return InvokeWith0(func() error {
+				panic("something went wrong")
+			}, WithObservers(recordingObserver(recorder)))
+		})
+		require.Error(t, err)
+
+		events, last := observedKinds(recorder)
+		assert.Equal(t, []string{"start", "panic"}, events)
+
+		var panicErr *PanicError
+		require.ErrorAs(t, last.Err, &panicErr)
+		assert.Equal(t, "something went wrong", panicErr.Value)
+	})
+
+	t.Run("Attempts", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewRegistry()
+		r.Set("test.retry", Policy{Retries: 2})
+
+		recorder := &testRecorder[observedEvent]{}
+
+		err := InvokeWith0(func() error {
+			return assert.AnError
+		}, WithName("test.retry"), WithRegistry(r), WithObservers(recordingObserver(recorder)))
+		require.Error(t, err)
+
+		events, last := observedKinds(recorder)
+		assert.Equal(t, []string{"start", "finish", "start", "finish", "start", "finish"}, events)
+		assert.Equal(t, 3, last.Attempt)
+	})
+}
+
+func TestSetObservers(t *testing.T) {
+	recorder := &testRecorder[observedEvent]{}
+
+	SetObservers(recordingObserver(recorder))
+	defer SetObservers()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	res, err := Invoke(ctx, func() (string, error) {
+		return "foo", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "foo", res)
+
+	events, _ := observedKinds(recorder)
+	assert.Contains(t, events, "start")
+	assert.Contains(t, events, "finish")
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	t.Parallel()
+
+	h := NewLatencyHistogram(100*time.Millisecond, 10*time.Millisecond)
+
+	h.Observe("foo", 5*time.Millisecond)
+	h.Observe("foo", 50*time.Millisecond)
+	h.Observe("foo", 60*time.Millisecond)
+	h.Observe("foo", time.Second)
+
+	snapshot := h.Snapshot("foo")
+	assert.Equal(t, []time.Duration{10 * time.Millisecond, 100 * time.Millisecond}, snapshot.Buckets)
+	assert.Equal(t, []uint64{1, 2, 1}, snapshot.Counts)
+	assert.Equal(t, uint64(4), snapshot.Count)
+	assert.Equal(t, 1115*time.Millisecond, snapshot.Sum)
+
+	assert.Equal(t, 10*time.Millisecond, snapshot.Quantile(0.25))
+	assert.Equal(t, 55*time.Millisecond, snapshot.Quantile(0.5))
+	assert.Equal(t, 100*time.Millisecond, snapshot.Quantile(0.99))
+
+	assert.Equal(t, uint64(0), h.Snapshot("bar").Count)
+	assert.Equal(t, time.Duration(0), h.Snapshot("bar").Quantile(0.5))
+
+	err := InvokeWith0(func() error {
+		return nil
+	}, WithName("bar"), WithObservers(h))
+	require.NoError(t, err)
+
+	snapshots := h.Snapshots()
+	assert.Len(t, snapshots, 2)
+	assert.Equal(t, uint64(1), snapshots["bar"].Count)
+}
+
+func TestSlowCallDetector(t *testing.T) {
+	t.Parallel()
+
+	slowCalls := &testRecorder[string]{}
+
+	detector := NewSlowCallDetector(20*time.Millisecond, func(event InvocationEvent) {
+		slowCalls.record(event.Name)
+	})
+
+	_ = InvokeWith0(func() error {
+		return nil
+	}, WithName("fast"), WithObservers(detector))
+	_ = InvokeWith0(func() error {
+		time.Sleep(30 * time.Millisecond)
+		return nil
+	}, WithName("slow"), WithObservers(detector))
+	_ = InvokeWith0(func() error {
+		time.Sleep(time.Second)
+		return nil
+	}, WithName("timeout"), WithContextTimeout(30*time.Millisecond), WithObservers(detector))
+
+	assert.Equal(t, []string{"slow", "timeout"}, slowCalls.snapshot())
+}
@@ -0,0 +1,57 @@
+package fo
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the error that wraps the value recovered from a
+// panicking callback function, along with the stack trace of the
+// goroutine at the time it panicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+// newPanicError creates a new PanicError with the recovered value and
+// the stack trace of the current goroutine. If the recovered value is
+// already a *PanicError re-panicked by invoke, it will be returned as is
+// to keep the stack trace of the goroutine that originally panicked.
+func newPanicError(value any) *PanicError {
+	if panicErr, ok := value.(*PanicError); ok {
+		return panicErr
+	}
+
+	return &PanicError{
+		Value: value,
+		Stack: debug.Stack(),
+	}
+}
+
+// Error implements the error interface.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the recovered value if it is an error, so that
+// errors.Is(...) and errors.As(...) can be used against it.
+func (e *PanicError) Unwrap() error {
+	err, ok := e.Value.(error)
+	if !ok {
+		return nil
+	}
+
+	return err
+}
+
+// callWithPanicRecovery calls fn and converts any panic raised by fn
+// into a *PanicError.
+func callWithPanicRecovery(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newPanicError(r)
+		}
+	}()
+
+	return fn()
+}
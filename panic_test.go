@@ -0,0 +1,47 @@
+package fo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallWithPanicRecovery(t *testing.T) {
+	t.Parallel()
+
+	t.Run("NoPanic", func(t *testing.T) {
+		t.Parallel()
+
+		err := callWithPanicRecovery(func() error {
+			return assert.AnError
+		})
+		assert.Equal(t, assert.AnError, err)
+	})
+
+	t.Run("PanicWithValue", func(t *testing.T) {
+		t.Parallel()
+
+		err := callWithPanicRecovery(func() error {
+			panic(42)
+		})
+		require.Error(t, err)
+
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+		assert.Equal(t, 42, panicErr.Value)
+		assert.Contains(t, string(panicErr.Stack), "panic_test.go")
+		assert.NoError(t, errors.Unwrap(err))
+	})
+
+	t.Run("PanicWithError", func(t *testing.T) {
+		t.Parallel()
+
+		err := callWithPanicRecovery(func() error {
+			panic(assert.AnError)
+		})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
@@ -0,0 +1,121 @@
+package fo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.uber.org/multierr"
+)
+
+var (
+	// ErrNoQuorum is the error returned by InvokeQuorum(...) when less than
+	// k callback functions agree on the result.
+	ErrNoQuorum = errors.New("fo: no quorum")
+)
+
+// quorumVote is a distinct result and the number of the callback
+// functions returned it.
+type quorumVote[R any] struct {
+	result R
+	votes  int
+}
+
+// InvokeQuorum invokes all the callback functions concurrently with the
+// call options applied, e.g. the reads of the replicas, and returns the
+// result as soon as k of them return results equal to each other by the
+// equality function, reflect.DeepEqual is used if equal is nil. The
+// context of the callback functions still running is canceled once the
+// quorum is reached.
+//
+// ErrNoQuorum is returned, together with the errors of the callback
+// functions, as soon as the quorum becomes unreachable, which includes
+// ctx being done before the quorum is reached.
+//
+//	user, err := fo.InvokeQuorum(ctx, []func(ctx context.Context) (User, error){
+//		replica1.GetUser, replica2.GetUser, replica3.GetUser,
+//	}, 2, func(a, b User) bool {
+//		return a.Version == b.Version
+//	}, fo.WithContextTimeout(time.Second))
+func InvokeQuorum[R any](ctx context.Context, fns []func(ctx context.Context) (R, error), k int, equal func(a, b R) bool, opts ...CallInvokeWithOption) (R, error) {
+	var empty R
+
+	if k <= 0 || k > len(fns) {
+		return empty, fmt.Errorf("%w: %d required out of %d", ErrNoQuorum, k, len(fns))
+	}
+	if equal == nil {
+		equal = func(a, b R) bool {
+			return reflect.DeepEqual(a, b)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type quorumResult struct {
+		res R
+		err error
+	}
+
+	results := make(chan quorumResult, len(fns))
+
+	for _, fn := range fns {
+		go func() {
+			var res R
+
+			err := callWithPanicRecovery(func() error {
+				var err error
+				res, err = InvokeWithContext(ctx, fn, opts...)
+
+				return err
+			})
+
+			results <- quorumResult{res: res, err: err}
+		}()
+	}
+
+	votes := make([]*quorumVote[R], 0, len(fns))
+	errs := make([]error, 0)
+	agreed := 0
+
+	for received := 1; received <= len(fns); received++ {
+		result := <-results
+		if result.err != nil {
+			errs = append(errs, result.err)
+		} else {
+			vote := quorumVoteOf(votes, result.res, equal)
+			if vote == nil {
+				vote = &quorumVote[R]{result: result.res}
+				votes = append(votes, vote)
+			}
+
+			vote.votes++
+			if vote.votes >= k {
+				return vote.result, nil
+			}
+
+			agreed = max(agreed, vote.votes)
+		}
+
+		if agreed+len(fns)-received < k {
+			break
+		}
+	}
+
+	if len(errs) == 0 {
+		return empty, fmt.Errorf("%w: %d agreed, %d required", ErrNoQuorum, agreed, k)
+	}
+
+	return empty, fmt.Errorf("%w: %d agreed, %d required: %w", ErrNoQuorum, agreed, k, multierr.Combine(errs...))
+}
+
+func quorumVoteOf[R any](votes []*quorumVote[R], result R, equal func(a, b R) bool) *quorumVote[R] {
+	for _, vote := range votes {
+		if equal(vote.result, result) {
+			return vote
+		}
+	}
+
+	return nil
+}
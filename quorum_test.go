@@ -0,0 +1,142 @@
+package fo
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvokeQuorum(t *testing.T) {
+	t.Parallel()
+
+	replica := func(res int, err error, delay time.Duration) func(ctx context.Context) (int, error) {
+		return func(ctx context.Context) (int, error) {
+			select {
+			case <-time.After(delay):
+				return res, err
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}
+	}
+
+	t.Run("Reached", func(t *testing.T) {
+		t.Parallel()
+
+		var canceled atomic.Bool
+
+		start := time.Now()
+
+		res, err := InvokeQuorum(context.Background(), []func(ctx context.Context) (int, error){
+			replica(1, nil, 0),
+			replica(1, nil, 10*time.Millisecond),
+			func(ctx context.Context) (int, error) {
+				<-ctx.Done()
+				canceled.Store(true)
+
+				return 0, ctx.Err()
+			},
+		}, 2, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 1, res)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+		// the context of the straggler is canceled once the quorum is reached
+		assert.Eventually(t, canceled.Load, time.Second, time.Millisecond)
+	})
+
+	t.Run("Equal", func(t *testing.T) {
+		t.Parallel()
+
+		type user struct {
+			Name    string
+			Version int
+		}
+
+		fns := []func(ctx context.Context) (user, error){
+			func(ctx context.Context) (user, error) { return user{Name: "a", Version: 1}, nil },
+			func(ctx context.Context) (user, error) { return user{Name: "b", Version: 2}, nil },
+			func(ctx context.Context) (user, error) { return user{Name: "c", Version: 2}, nil },
+		}
+
+		res, err := InvokeQuorum(context.Background(), fns, 2, func(a, b user) bool {
+			return a.Version == b.Version
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, res.Version)
+	})
+
+	t.Run("Disagreed", func(t *testing.T) {
+		t.Parallel()
+
+		errReplica := errors.New("replica unavailable")
+
+		res, err := InvokeQuorum(context.Background(), []func(ctx context.Context) (int, error){
+			replica(1, nil, 0),
+			replica(2, nil, 0),
+			replica(0, errReplica, 0),
+		}, 2, nil)
+		require.ErrorIs(t, err, ErrNoQuorum)
+		require.ErrorIs(t, err, errReplica)
+		assert.Zero(t, res)
+	})
+
+	t.Run("Unreachable", func(t *testing.T) {
+		t.Parallel()
+
+		errReplica := errors.New("replica unavailable")
+
+		start := time.Now()
+
+		// fails without waiting for the slow replica once the quorum is unreachable
+		_, err := InvokeQuorum(context.Background(), []func(ctx context.Context) (int, error){
+			replica(0, errReplica, 0),
+			replica(0, errReplica, 0),
+			replica(1, nil, time.Second),
+		}, 2, nil)
+		require.ErrorIs(t, err, ErrNoQuorum)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, err := InvokeQuorum(ctx, []func(ctx context.Context) (int, error){
+			replica(1, nil, 0),
+			replica(1, nil, time.Second),
+			replica(1, nil, time.Second),
+		}, 2, nil)
+		require.ErrorIs(t, err, ErrNoQuorum)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("Panicked", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := InvokeQuorum(context.Background(), []func(ctx context.Context) (int, error){
+			replica(1, nil, 0),
+			func(ctx context.Context) (int, error) { panic("boom") },
+		}, 2, nil)
+		require.ErrorIs(t, err, ErrNoQuorum)
+
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+	})
+
+	t.Run("InvalidQuorum", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := InvokeQuorum(context.Background(), []func(ctx context.Context) (int, error){
+			replica(1, nil, 0),
+		}, 2, nil)
+		require.ErrorIs(t, err, ErrNoQuorum)
+	})
+}
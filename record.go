@@ -0,0 +1,297 @@
+package fo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoRecording is the error returned by named invocations replayed
+	// by a Replayer when there is no recording for the name and key.
+	ErrNoRecording = errors.New("no recording found")
+)
+
+var (
+	cassetteMutex  = sync.RWMutex{}
+	globalRecorder *Recorder
+	globalReplayer *Replayer
+)
+
+// SetRecorder sets the global Recorder that records every named
+// invocation made by InvokeWith* and InvokeWithTimeout*, passing nil
+// disables the global recording.
+//
+// NOTICE: This function will replace the global existing recorder on
+// package fo level.
+func SetRecorder(recorder *Recorder) {
+	cassetteMutex.Lock()
+	defer cassetteMutex.Unlock()
+
+	globalRecorder = recorder
+}
+
+// SetReplayer sets the global Replayer that replays every named
+// invocation made by InvokeWith* and InvokeWithTimeout*, passing nil
+// disables the global replaying.
+//
+// NOTICE: This function will replace the global existing replayer on
+// package fo level.
+func SetReplayer(replayer *Replayer) {
+	cassetteMutex.Lock()
+	defer cassetteMutex.Unlock()
+
+	globalReplayer = replayer
+}
+
+func currentRecorder() *Recorder {
+	cassetteMutex.RLock()
+	defer cassetteMutex.RUnlock()
+
+	return globalRecorder
+}
+
+func currentReplayer() *Replayer {
+	cassetteMutex.RLock()
+	defer cassetteMutex.RUnlock()
+
+	return globalReplayer
+}
+
+// CassetteEntry is a single recorded invocation, stored as one line of
+// JSON in a cassette.
+type CassetteEntry struct {
+	Name    string          `json:"name"`
+	Key     string          `json:"key,omitempty"`
+	Results json.RawMessage `json:"results"`
+	Error   string          `json:"error,omitempty"`
+	Latency Duration        `json:"latency"`
+}
+
+// Recorder records the results, errors and latency of named invocations
+// into a JSON-lines cassette, which can be replayed by Replayer later.
+//
+// Enable it per call with WithRecorder(...), or globally with
+// SetRecorder(...). Use WithRecordKey(...) to distinguish the
+// invocations with the same name but different arguments.
+type Recorder struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	closer io.Closer
+	err    error
+}
+
+// NewRecorder creates a new Recorder that writes the cassette to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		writer: w,
+	}
+}
+
+// NewFileRecorder creates a new Recorder that writes the cassette to the
+// file at path, the file will be truncated if it exists. The file should
+// be closed with Close() after recording.
+func NewFileRecorder(path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("recorder: failed to create cassette file: %w", err)
+	}
+
+	recorder := NewRecorder(file)
+	recorder.closer = file
+
+	return recorder, nil
+}
+
+// Err returns the first error occurred while recording.
+func (r *Recorder) Err() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.err
+}
+
+// Close closes the underlying file if the Recorder is created by
+// NewFileRecorder, and returns the first error occurred while recording
+// or closing.
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closer != nil {
+		err := r.closer.Close()
+		if err != nil && r.err == nil {
+			r.err = err
+		}
+
+		r.closer = nil
+	}
+
+	return r.err
+}
+
+func (r *Recorder) record(name, key string, results any, err error, latency time.Duration) {
+	entry := CassetteEntry{
+		Name:    name,
+		Key:     key,
+		Latency: Duration(latency),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	entry.Results, r.err = json.Marshal(results)
+	if r.err != nil {
+		r.err = fmt.Errorf("recorder: failed to encode results of '%s': %w", name, r.err)
+		return
+	}
+
+	line, marshalErr := json.Marshal(entry)
+	if marshalErr != nil {
+		r.err = fmt.Errorf("recorder: failed to encode entry of '%s': %w", name, marshalErr)
+		return
+	}
+
+	_, r.err = r.writer.Write(append(line, '\n'))
+}
+
+type cassetteKey struct {
+	name string
+	key  string
+}
+
+// Replayer replays the invocations recorded by Recorder, the named
+// invocations are served with the recorded results and errors instead
+// of calling the callback functions.
+//
+// The recordings with the same name and key are served in the recorded
+// order, and the last one will be served repeatedly once the others are
+// used up. ErrNoRecording is returned if there is no recording at all.
+//
+// Enable it per call with WithReplayer(...), or globally with
+// SetReplayer(...).
+type Replayer struct {
+	mutex   sync.Mutex
+	entries map[cassetteKey][]CassetteEntry
+}
+
+// NewReplayer creates a new Replayer that reads the cassette from r.
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	replayer := &Replayer{
+		entries: make(map[cassetteKey][]CassetteEntry),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry CassetteEntry
+
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, fmt.Errorf("replayer: failed to decode line %d of cassette: %w", line, err)
+		}
+
+		key := cassetteKey{name: entry.Name, key: entry.Key}
+		replayer.entries[key] = append(replayer.entries[key], entry)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("replayer: failed to read cassette: %w", err)
+	}
+
+	return replayer, nil
+}
+
+// NewFileReplayer creates a new Replayer that reads the cassette from
+// the file at path.
+func NewFileReplayer(path string) (*Replayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("replayer: failed to open cassette file: %w", err)
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return NewReplayer(file)
+}
+
+func (r *Replayer) next(name, key string) (CassetteEntry, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	k := cassetteKey{name: name, key: key}
+
+	entries := r.entries[k]
+	if len(entries) == 0 {
+		return CassetteEntry{}, false
+	}
+	if len(entries) > 1 {
+		r.entries[k] = entries[1:]
+	}
+
+	return entries[0], true
+}
+
+// replay serves the next recording of the invocation with name and key.
+func replay[R any](replayer *Replayer, name, key string, decoder resultsDecoder) (R, error) {
+	var res R
+
+	entry, ok := replayer.next(name, key)
+	if !ok {
+		return res, fmt.Errorf("replayer: '%s' with key '%s': %w", name, key, ErrNoRecording)
+	}
+
+	if len(entry.Results) > 0 {
+		var err error
+
+		res, err = decodeResults[R](entry.Results, decoder)
+		if err != nil {
+			return res, fmt.Errorf("replayer: failed to decode results of '%s': %w", name, err)
+		}
+	}
+
+	return res, replayedError(entry.Error)
+}
+
+// replayedError restores the recorded error message as an error, the
+// well known context errors are restored as the sentinel ones so that
+// errors.Is(...) keeps working.
+func replayedError(message string) error {
+	switch message {
+	case "":
+		return nil
+	case context.DeadlineExceeded.Error():
+		return context.DeadlineExceeded
+	case context.Canceled.Error():
+		return context.Canceled
+	case ErrCircuitOpen.Error():
+		return ErrCircuitOpen
+	case ErrIdleTimeout.Error():
+		return ErrIdleTimeout
+	case ErrInsufficientTime.Error():
+		return ErrInsufficientTime
+	default:
+		return errors.New(message)
+	}
+}
@@ -0,0 +1,138 @@
+package fo
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Buffer", func(t *testing.T) {
+		t.Parallel()
+
+		buffer := new(bytes.Buffer)
+		recorder := NewRecorder(buffer)
+
+		var calls atomic.Int32
+
+		getUser := func(id string) func() (string, int, error) {
+			return func() (string, int, error) {
+				calls.Add(1)
+				if id == "unknown" {
+					return "", 0, assert.AnError
+				}
+
+				return "user-" + id, len(id), nil
+			}
+		}
+
+		name, length, err := InvokeWith2(getUser("1"), WithName("users.get"), WithRecordKey("1"), WithRecorder(recorder))
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", name)
+		assert.Equal(t, 1, length)
+
+		_, _, err = InvokeWith2(getUser("unknown"), WithName("users.get"), WithRecordKey("unknown"), WithRecorder(recorder))
+		require.Error(t, err)
+
+		err = InvokeWith0(func() error {
+			time.Sleep(time.Second)
+			return nil
+		}, WithName("users.sync"), WithContextTimeout(10*time.Millisecond), WithRecorder(recorder))
+		require.Error(t, err)
+
+		// unnamed invocations are not recorded
+		_, err = InvokeWith(func() (string, error) {
+			return "", nil
+		}, WithRecorder(recorder))
+		require.NoError(t, err)
+
+		require.NoError(t, recorder.Close())
+		assert.Equal(t, 3, strings.Count(buffer.String(), "\n"))
+		assert.Equal(t, int32(2), calls.Load())
+
+		replayer, err := NewReplayer(buffer)
+		require.NoError(t, err)
+
+		name, length, err = InvokeWith2(getUser("1"), WithName("users.get"), WithRecordKey("1"), WithReplayer(replayer))
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", name)
+		assert.Equal(t, 1, length)
+
+		_, _, err = InvokeWith2(getUser("unknown"), WithName("users.get"), WithRecordKey("unknown"), WithReplayer(replayer))
+		require.Error(t, err)
+		assert.EqualError(t, err, assert.AnError.Error())
+
+		err = InvokeWith0(func() error {
+			return nil
+		}, WithName("users.sync"), WithReplayer(replayer))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		_, _, err = InvokeWith2(getUser("2"), WithName("users.get"), WithRecordKey("2"), WithReplayer(replayer))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrNoRecording)
+
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("File", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+		recorder, err := NewFileRecorder(path)
+		require.NoError(t, err)
+
+		for i := 1; i <= 2; i++ {
+			_, err = InvokeWith(func() (int, error) {
+				return i, nil
+			}, WithName("counter"), WithRecorder(recorder))
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, recorder.Close())
+
+		replayer, err := NewFileReplayer(path)
+		require.NoError(t, err)
+
+		for _, expected := range []int{1, 2, 2} {
+			res, err := InvokeWith(func() (int, error) {
+				return 0, nil
+			}, WithName("counter"), WithReplayer(replayer))
+			require.NoError(t, err)
+			assert.Equal(t, expected, res)
+		}
+	})
+
+	t.Run("InvalidCassette", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewReplayer(strings.NewReader("{\"name\":\"foo\"}\nnot json\n"))
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "line 2")
+
+		_, err = NewFileReplayer(filepath.Join(t.TempDir(), "not-exist.jsonl"))
+		require.Error(t, err)
+	})
+
+	t.Run("UnencodableResults", func(t *testing.T) {
+		t.Parallel()
+
+		recorder := NewRecorder(new(bytes.Buffer))
+
+		_, err := InvokeWith(func() (chan int, error) {
+			return make(chan int), nil
+		}, WithName("chan"), WithRecorder(recorder))
+		require.NoError(t, err)
+		require.Error(t, recorder.Err())
+	})
+}
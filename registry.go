@@ -0,0 +1,321 @@
+package fo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	registryMutex   = sync.RWMutex{}
+	defaultRegistry = NewRegistry()
+)
+
+// SetRegistry sets the global Registry that named invocations (see
+// WithName) look up their policies from.
+//
+// NOTICE: This function will replace the global existing registry on
+// package fo level.
+func SetRegistry(registry *Registry) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	defaultRegistry = registry
+}
+
+// DefaultRegistry returns the global Registry.
+func DefaultRegistry() *Registry {
+	return currentRegistry()
+}
+
+func currentRegistry() *Registry {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	return defaultRegistry
+}
+
+// Duration is a time.Duration that can be unmarshalled from either a
+// duration string like "1.5s" or an integer of nanoseconds in JSON and
+// YAML.
+type Duration time.Duration
+
+// Duration returns the value as time.Duration.
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v any
+
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+
+	return d.set(v)
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var v any
+
+	err := value.Decode(&v)
+	if err != nil {
+		return err
+	}
+
+	return d.set(v)
+}
+
+func (d *Duration) set(v any) error {
+	switch value := v.(type) {
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+
+		*d = Duration(parsed)
+	case float64:
+		*d = Duration(value)
+	case int:
+		*d = Duration(value)
+	default:
+		return fmt.Errorf("invalid duration type '%v', should either be a string or a number", reflect.TypeOf(v))
+	}
+
+	return nil
+}
+
+// BreakerPolicy configures the circuit breaker of a Policy.
+type BreakerPolicy struct {
+	// FailureThreshold is the number of consecutive failures that opens
+	// the breaker, the panics of the callback functions count as failures.
+	FailureThreshold int `json:"failureThreshold" yaml:"failureThreshold"`
+	// OpenDuration is how long the breaker stays open before letting a
+	// trial call through.
+	OpenDuration Duration `json:"openDuration" yaml:"openDuration"`
+}
+
+// Policy describes how the invocations with the same name should be
+// invoked.
+type Policy struct {
+	// Timeout is the timeout of each attempt, it will be overridden by
+	// WithContextTimeout(...) if set on the call site.
+	Timeout Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// Retries is the number of retries after the first failed attempt.
+	Retries int `json:"retries,omitempty" yaml:"retries,omitempty"`
+	// RetryBackoff is the time to wait between attempts.
+	RetryBackoff Duration `json:"retryBackoff,omitempty" yaml:"retryBackoff,omitempty"`
+	// Breaker enables the circuit breaker if set.
+	Breaker *BreakerPolicy `json:"breaker,omitempty" yaml:"breaker,omitempty"`
+	// ConcurrencyLimit limits the number of the running callback functions
+	// if positive, the exceeded invocations will wait until the timeout.
+	ConcurrencyLimit int `json:"concurrencyLimit,omitempty" yaml:"concurrencyLimit,omitempty"`
+}
+
+// policyState is the runtime state of a Policy, shared by all the
+// invocations with the same name.
+type policyState struct {
+	policy  Policy
+	breaker *breaker
+	sem     chan struct{}
+}
+
+func newPolicyState(policy Policy) *policyState {
+	state := &policyState{
+		policy: policy,
+	}
+	if policy.Breaker != nil {
+		state.breaker = newBreaker(*policy.Breaker)
+	}
+	if policy.ConcurrencyLimit > 0 {
+		state.sem = make(chan struct{}, policy.ConcurrencyLimit)
+	}
+
+	return state
+}
+
+// acquire acquires a slot under the concurrency limit of the policy, and
+// returns the function to release the slot.
+func (s *policyState) acquire(ctx context.Context) (func(), error) {
+	if s.sem == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case s.sem <- struct{}{}:
+		return func() { <-s.sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Registry holds the policies of named invocations. The policies can be
+// set programmatically or loaded from JSON or YAML, and can be reloaded
+// at runtime, invocations started after the reloading will pick up the
+// new policies.
+//
+// The JSON and YAML documents are objects that map names to policies:
+//
+//	{
+//	  "payments.charge": {
+//	    "timeout": "2s",
+//	    "retries": 2,
+//	    "retryBackoff": "100ms",
+//	    "breaker": { "failureThreshold": 5, "openDuration": "30s" },
+//	    "concurrencyLimit": 10
+//	  }
+//	}
+type Registry struct {
+	mutex  sync.RWMutex
+	states map[string]*policyState
+}
+
+// NewRegistry creates a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		states: make(map[string]*policyState),
+	}
+}
+
+// Set sets the policy for the name. The runtime state of the breaker
+// and concurrency limit will be kept if the policy didn't change.
+func (r *Registry) Set(name string, policy Policy) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.set(name, policy)
+}
+
+func (r *Registry) set(name string, policy Policy) {
+	state, ok := r.states[name]
+	if ok && reflect.DeepEqual(state.policy, policy) {
+		return
+	}
+
+	r.states[name] = newPolicyState(policy)
+}
+
+// Delete removes the policy for the name.
+func (r *Registry) Delete(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.states, name)
+}
+
+// Policy returns the policy for the name and whether it exists.
+func (r *Registry) Policy(name string) (Policy, bool) {
+	state := r.lookup(name)
+	if state == nil {
+		return Policy{}, false
+	}
+
+	return state.policy, true
+}
+
+// Names returns the names of all the registered policies.
+func (r *Registry) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.states))
+	for name := range r.states {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// Load replaces all the policies in the registry with the given ones.
+func (r *Registry) Load(policies map[string]Policy) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for name := range r.states {
+		if _, ok := policies[name]; !ok {
+			delete(r.states, name)
+		}
+	}
+	for name, policy := range policies {
+		r.set(name, policy)
+	}
+}
+
+// LoadJSON replaces all the policies in the registry with the ones
+// decoded from the JSON document.
+func (r *Registry) LoadJSON(data []byte) error {
+	policies := make(map[string]Policy)
+
+	err := json.Unmarshal(data, &policies)
+	if err != nil {
+		return fmt.Errorf("registry: failed to decode JSON policies: %w", err)
+	}
+
+	r.Load(policies)
+
+	return nil
+}
+
+// LoadYAML replaces all the policies in the registry with the ones
+// decoded from the YAML document.
+func (r *Registry) LoadYAML(data []byte) error {
+	policies := make(map[string]Policy)
+
+	err := yaml.Unmarshal(data, &policies)
+	if err != nil {
+		return fmt.Errorf("registry: failed to decode YAML policies: %w", err)
+	}
+
+	r.Load(policies)
+
+	return nil
+}
+
+// LoadFile replaces all the policies in the registry with the ones
+// decoded from the file, the format is determined by the file extension,
+// .json for JSON, .yaml and .yml for YAML. It can be called again to
+// reload the policies.
+func (r *Registry) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("registry: failed to read policies file: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		return r.LoadJSON(data)
+	case ".yaml", ".yml":
+		return r.LoadYAML(data)
+	default:
+		return fmt.Errorf("registry: unsupported policies file extension '%s', should be one of .json, .yaml, .yml", ext)
+	}
+}
+
+func (r *Registry) lookup(name string) *policyState {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.states[name]
+}
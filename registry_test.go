@@ -0,0 +1,289 @@
+package fo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryLoad(t *testing.T) {
+	t.Parallel()
+
+	t.Run("JSON", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewRegistry()
+		err := r.LoadJSON([]byte(`{
+			"payments.charge": {
+				"timeout": "2s",
+				"retries": 2,
+				"retryBackoff": 100000000,
+				"breaker": { "failureThreshold": 5, "openDuration": "30s" },
+				"concurrencyLimit": 10
+			}
+		}`))
+		require.NoError(t, err)
+
+		policy, ok := r.Policy("payments.charge")
+		require.True(t, ok)
+		assert.Equal(t, Policy{
+			Timeout:          Duration(2 * time.Second),
+			Retries:          2,
+			RetryBackoff:     Duration(100 * time.Millisecond),
+			Breaker:          &BreakerPolicy{FailureThreshold: 5, OpenDuration: Duration(30 * time.Second)},
+			ConcurrencyLimit: 10,
+		}, policy)
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewRegistry()
+		err := r.LoadYAML([]byte(`
+payments.charge:
+  timeout: 2s
+  retries: 2
+  retryBackoff: 100ms
+`))
+		require.NoError(t, err)
+
+		policy, ok := r.Policy("payments.charge")
+		require.True(t, ok)
+		assert.Equal(t, Policy{
+			Timeout:      Duration(2 * time.Second),
+			Retries:      2,
+			RetryBackoff: Duration(100 * time.Millisecond),
+		}, policy)
+	})
+
+	t.Run("InvalidDuration", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewRegistry()
+		require.Error(t, r.LoadJSON([]byte(`{"foo": {"timeout": "abc"}}`)))
+		require.Error(t, r.LoadJSON([]byte(`{"foo": {"timeout": true}}`)))
+		require.Error(t, r.LoadYAML([]byte(`foo: {timeout: abc}`)))
+	})
+
+	t.Run("File", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		jsonPath := filepath.Join(dir, "policies.json")
+		require.NoError(t, os.WriteFile(jsonPath, []byte(`{"foo": {"timeout": "1s"}}`), 0o600))
+
+		yamlPath := filepath.Join(dir, "policies.yml")
+		require.NoError(t, os.WriteFile(yamlPath, []byte("bar:\n  timeout: 2s\n"), 0o600))
+
+		r := NewRegistry()
+
+		require.NoError(t, r.LoadFile(jsonPath))
+		assert.Equal(t, []string{"foo"}, r.Names())
+
+		// reloading replaces the existing policies
+		require.NoError(t, r.LoadFile(yamlPath))
+		assert.Equal(t, []string{"bar"}, r.Names())
+
+		policy, ok := r.Policy("bar")
+		require.True(t, ok)
+		assert.Equal(t, Duration(2*time.Second), policy.Timeout)
+
+		require.Error(t, r.LoadFile(filepath.Join(dir, "policies.toml")))
+	})
+
+	t.Run("KeepStateIfUnchanged", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewRegistry()
+		r.Set("foo", Policy{ConcurrencyLimit: 1})
+
+		state := r.lookup("foo")
+
+		r.Load(map[string]Policy{"foo": {ConcurrencyLimit: 1}})
+		assert.Same(t, state, r.lookup("foo"))
+
+		r.Load(map[string]Policy{"foo": {ConcurrencyLimit: 2}})
+		assert.NotSame(t, state, r.lookup("foo"))
+
+		r.Delete("foo")
+		assert.Nil(t, r.lookup("foo"))
+	})
+}
+
+func TestInvokeWithName(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Timeout", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewRegistry()
+		r.Set("slow", Policy{Timeout: Duration(10 * time.Millisecond)})
+
+		start := time.Now()
+		_, err := InvokeWith(func() (string, error) {
+			time.Sleep(time.Second)
+			return "", nil
+		}, WithName("slow"), WithRegistry(r))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+		// the timeout on the call site takes precedence
+		res, err := InvokeWith(func() (string, error) {
+			time.Sleep(50 * time.Millisecond)
+			return "foo", nil
+		}, WithName("slow"), WithRegistry(r), WithContextTimeout(time.Second))
+		require.NoError(t, err)
+		assert.Equal(t, "foo", res)
+
+		// reloaded at runtime
+		r.Set("slow", Policy{Timeout: Duration(time.Second)})
+
+		res, err = InvokeWith(func() (string, error) {
+			time.Sleep(50 * time.Millisecond)
+			return "bar", nil
+		}, WithName("slow"), WithRegistry(r))
+		require.NoError(t, err)
+		assert.Equal(t, "bar", res)
+	})
+
+	t.Run("Retries", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewRegistry()
+		r.Set("flaky", Policy{Retries: 2})
+
+		var attempts atomic.Int32
+
+		res, err := InvokeWith(func() (int32, error) {
+			n := attempts.Add(1)
+			if n < 3 {
+				return 0, assert.AnError
+			}
+
+			return n, nil
+		}, WithName("flaky"), WithRegistry(r))
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), res)
+
+		attempts.Store(0)
+
+		err = InvokeWith0(func() error {
+			attempts.Add(1)
+			return assert.AnError
+		}, WithName("flaky"), WithRegistry(r))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Equal(t, int32(3), attempts.Load())
+	})
+
+	t.Run("Breaker", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewRegistry()
+		r.Set("broken", Policy{Breaker: &BreakerPolicy{FailureThreshold: 2, OpenDuration: Duration(time.Minute)}})
+
+		var calls atomic.Int32
+
+		fn := func() error {
+			calls.Add(1)
+			return assert.AnError
+		}
+
+		assert.ErrorIs(t, InvokeWith0(fn, WithName("broken"), WithRegistry(r)), assert.AnError)
+		assert.ErrorIs(t, InvokeWith0(fn, WithName("broken"), WithRegistry(r)), assert.AnError)
+		assert.ErrorIs(t, InvokeWith0(fn, WithName("broken"), WithRegistry(r)), ErrCircuitOpen)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("Breaker panic", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewRegistry()
+		r.Set("panicky", Policy{Breaker: &BreakerPolicy{FailureThreshold: 1, OpenDuration: Duration(10 * time.Millisecond)}})
+
+		invoke := func(fn func() error) error {
+			return callWithPanicRecovery(func() error {
+				return InvokeWith0(fn, WithName("panicky"), WithRegistry(r))
+			})
+		}
+
+		err := invoke(func() error {
+			return assert.AnError
+		})
+		require.ErrorIs(t, err, assert.AnError)
+
+		time.Sleep(20 * time.Millisecond)
+
+		// the trial call of the half-open breaker panics
+		var panicErr *PanicError
+
+		err = invoke(func() error {
+			panic("something went wrong")
+		})
+		require.ErrorAs(t, err, &panicErr)
+		require.ErrorIs(t, invoke(func() error { return nil }), ErrCircuitOpen)
+
+		// the breaker is opened again instead of being stuck in half-open
+		time.Sleep(20 * time.Millisecond)
+		require.NoError(t, invoke(func() error { return nil }))
+	})
+
+	t.Run("ConcurrencyLimit", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewRegistry()
+		r.Set("limited", Policy{ConcurrencyLimit: 1, Timeout: Duration(50 * time.Millisecond)})
+
+		release := make(chan struct{})
+		started := make(chan struct{})
+
+		go func() {
+			_ = InvokeWith0(func() error {
+				close(started)
+				<-release
+				return nil
+			}, WithName("limited"), WithRegistry(r), WithContextTimeout(time.Second))
+		}()
+
+		<-started
+
+		err := InvokeWith0(func() error {
+			return nil
+		}, WithName("limited"), WithRegistry(r))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		close(release)
+
+		assert.Eventually(t, func() bool {
+			return InvokeWith0(func() error { return nil }, WithName("limited"), WithRegistry(r)) == nil
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("DefaultRegistry", func(t *testing.T) {
+		t.Parallel()
+
+		DefaultRegistry().Set("test.default", Policy{Timeout: Duration(10 * time.Millisecond)})
+		defer DefaultRegistry().Delete("test.default")
+
+		err := InvokeWith0(func() error {
+			time.Sleep(time.Second)
+			return nil
+		}, WithName("test.default"))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// unknown names are invoked as is
+		err = InvokeWith0(func() error {
+			return nil
+		}, WithName("test.unknown"))
+		assert.NoError(t, err)
+	})
+}
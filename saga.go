@@ -0,0 +1,255 @@
+package fo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	sagaCompensateSuffix = ".compensate"
+)
+
+// sagaStep is a step of Saga.
+type sagaStep struct {
+	name       string
+	action     func(ctx context.Context) error
+	compensate func(ctx context.Context) error
+	opts       []CallInvokeWithOption
+}
+
+// options returns the options of the step with the invocation name set.
+func (s *sagaStep) options(name string) []CallInvokeWithOption {
+	opts := make([]CallInvokeWithOption, 0, len(s.opts)+1)
+	opts = append(opts, s.opts...)
+
+	return append(opts, WithName(name))
+}
+
+// SagaCompensationError is the error returned by the compensation of a
+// step.
+type SagaCompensationError struct {
+	Step string
+	Err  error
+}
+
+// SagaError is the error returned by Saga.Run(...) when a step fails. It
+// records the failed step and the compensations failed afterwards.
+type SagaError struct {
+	// Step is the name of the failed step.
+	Step string
+	// Err is the error returned by the action of the failed step.
+	Err error
+	// Compensated is the names of the steps compensated successfully, in
+	// the order they are compensated.
+	Compensated []string
+	// CompensationErrs is the errors returned by the compensations that
+	// failed after all the retries, in the order they are compensated.
+	CompensationErrs []SagaCompensationError
+}
+
+// Error implements the error interface.
+func (e *SagaError) Error() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "saga: step '%s' failed: %v", e.Step, e.Err)
+
+	for _, compensationErr := range e.CompensationErrs {
+		fmt.Fprintf(&sb, "; compensation of step '%s' failed: %v", compensationErr.Step, compensationErr.Err)
+	}
+
+	return sb.String()
+}
+
+// Unwrap returns the error of the failed step and the errors of the
+// failed compensations, so that errors.Is(...) and errors.As(...) can be
+// used against any of them.
+func (e *SagaError) Unwrap() []error {
+	errs := make([]error, 0, 1+len(e.CompensationErrs))
+	errs = append(errs, e.Err)
+
+	for _, compensationErr := range e.CompensationErrs {
+		errs = append(errs, compensationErr.Err)
+	}
+
+	return errs
+}
+
+// Saga runs the steps of a multi-step workflow in order, and compensates
+// the completed steps in the reverse order once a step fails.
+//
+// The actions and the compensations are invoked with
+// InvokeWithContext0(...) with the options of the step, which means the
+// timeouts and the panic recovery apply to both of them. The action is
+// named after the step and the compensation is named after the step
+// with the ".compensate" suffix, so that different policies, e.g. more
+// retries for the compensations, can be registered for them in the
+// registry.
+//
+//	err := fo.NewSaga().
+//		Step("inventory.reserve", reserve, release, fo.WithContextTimeout(time.Second)).
+//		Step("payment.charge", charge, refund, fo.WithContextTimeout(5*time.Second)).
+//		Step("shipping.schedule", schedule, nil).
+//		Run(ctx)
+type Saga struct {
+	steps []*sagaStep
+
+	compensationRetries int
+	compensationBackoff time.Duration
+}
+
+// NewSaga creates a new Saga.
+func NewSaga() *Saga {
+	return &Saga{
+		steps: make([]*sagaStep, 0),
+	}
+}
+
+// Step adds a step with the action, the compensating action, which can be
+// nil if there is nothing to compensate, and the options to invoke both of
+// them with.
+func (s *Saga) Step(name string, action, compensate func(ctx context.Context) error, opts ...CallInvokeWithOption) *Saga {
+	s.steps = append(s.steps, &sagaStep{
+		name:       name,
+		action:     action,
+		compensate: compensate,
+		opts:       opts,
+	})
+
+	return s
+}
+
+// SetCompensationRetries sets the number of the retries of the failed
+// compensations and the backoff between them, in addition to the ones of
+// the policies in the registry.
+func (s *Saga) SetCompensationRetries(retries int, backoff time.Duration) *Saga {
+	s.compensationRetries = retries
+	s.compensationBackoff = backoff
+
+	return s
+}
+
+// Run runs the actions of the steps in order. Once an action fails, the
+// compensations of the completed steps are run in the reverse order, and
+// *SagaError is returned. The steps after ctx is done are not started
+// and are failed with the error of ctx.
+//
+// The action failed by timeout or cancellation may have been abandoned
+// while still running, and take effect after all, e.g. a charge that goes
+// through late. In that case Run waits for the abandoned action to exit,
+// and then runs the compensation of the failed step itself first, unless
+// the action was never called. Such compensations must tolerate the
+// action that never took effect.
+//
+// The compensations are run even if ctx is canceled, with a context that
+// is never canceled but keeps the values of ctx.
+func (s *Saga) Run(ctx context.Context) error {
+	for i, step := range s.steps {
+		entered, err := s.runAction(ctx, step)
+		if err != nil {
+			sagaErr := &SagaError{
+				Step: step.name,
+				Err:  err,
+			}
+
+			completed := s.steps[:i]
+			if entered && sagaActionMayComplete(err) {
+				completed = s.steps[:i+1]
+			}
+
+			s.compensate(context.WithoutCancel(ctx), completed, sagaErr)
+
+			return sagaErr
+		}
+	}
+
+	return nil
+}
+
+// runAction runs the action of the step, and waits for the abandoned
+// attempts of the action still running to exit. It reports whether the
+// action has ever been called.
+func (s *Saga) runAction(ctx context.Context, step *sagaStep) (bool, error) {
+	err := ctx.Err()
+	if err != nil {
+		return false, err
+	}
+
+	var entered atomic.Bool
+
+	exited := make(chan struct{})
+	turn := &keyedTurn{
+		release: func() {
+			close(exited)
+		},
+	}
+
+	err = callWithPanicRecovery(func() error {
+		return InvokeWithContext0(ctx, func(ctx context.Context) error {
+			err := turn.enter(ctx)
+			if err != nil {
+				return err
+			}
+
+			defer turn.exit()
+
+			entered.Store(true)
+
+			return step.action(ctx)
+		}, step.options(step.name)...)
+	})
+
+	turn.done()
+	<-exited
+
+	return entered.Load(), err
+}
+
+// sagaActionMayComplete reports whether the action failed with err may
+// still take effect, which is the case of the timeouts and cancellations,
+// except for the ones refused before calling the action.
+func sagaActionMayComplete(err error) bool {
+	if errors.Is(err, ErrInsufficientTime) {
+		return false
+	}
+
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, ErrShuttingDown)
+}
+
+// compensate runs the compensations of the completed steps in the reverse
+// order and records the results into sagaErr.
+func (s *Saga) compensate(ctx context.Context, completed []*sagaStep, sagaErr *SagaError) {
+	for i := len(completed) - 1; i >= 0; i-- {
+		step := completed[i]
+		if step.compensate == nil {
+			continue
+		}
+
+		var err error
+
+		for attempt := 0; attempt <= s.compensationRetries; attempt++ {
+			if attempt > 0 && s.compensationBackoff > 0 {
+				time.Sleep(s.compensationBackoff)
+			}
+
+			err = callWithPanicRecovery(func() error {
+				return InvokeWithContext0(ctx, step.compensate, step.options(step.name+sagaCompensateSuffix)...)
+			})
+			if err == nil {
+				break
+			}
+		}
+
+		if err != nil {
+			sagaErr.CompensationErrs = append(sagaErr.CompensationErrs, SagaCompensationError{Step: step.name, Err: err})
+			continue
+		}
+
+		sagaErr.Compensated = append(sagaErr.Compensated, step.name)
+	}
+}
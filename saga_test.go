@@ -0,0 +1,180 @@
+package fo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingStep returns the action or the compensation that records the
+// entry into the journal and returns err.
+func recordingStep(journal *testRecorder[string], entry string, err error) func(context.Context) error {
+	return func(context.Context) error {
+		journal.record(entry)
+		return err
+	}
+}
+
+func TestSaga(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Completed", func(t *testing.T) {
+		t.Parallel()
+
+		journal := &testRecorder[string]{}
+
+		err := NewSaga().
+			Step("reserve", recordingStep(journal, "reserve", nil), recordingStep(journal, "release", nil)).
+			Step("charge", recordingStep(journal, "charge", nil), recordingStep(journal, "refund", nil)).
+			Run(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"reserve", "charge"}, journal.snapshot())
+	})
+
+	t.Run("Compensated", func(t *testing.T) {
+		t.Parallel()
+
+		journal := &testRecorder[string]{}
+
+		err := NewSaga().
+			Step("reserve", recordingStep(journal, "reserve", nil), recordingStep(journal, "release", nil)).
+			Step("notify", recordingStep(journal, "notify", nil), nil).
+			Step("charge", recordingStep(journal, "charge", nil), recordingStep(journal, "refund", nil)).
+			Step("ship", recordingStep(journal, "ship", assert.AnError), recordingStep(journal, "cancel shipment", nil)).
+			Run(context.Background())
+		require.ErrorIs(t, err, assert.AnError)
+		assert.Equal(t, []string{"reserve", "notify", "charge", "ship", "refund", "release"}, journal.snapshot())
+
+		var sagaErr *SagaError
+		require.ErrorAs(t, err, &sagaErr)
+		assert.Equal(t, "ship", sagaErr.Step)
+		assert.Equal(t, []string{"charge", "reserve"}, sagaErr.Compensated)
+		assert.Empty(t, sagaErr.CompensationErrs)
+		assert.Equal(t, "saga: step 'ship' failed: "+assert.AnError.Error(), err.Error())
+	})
+
+	t.Run("Compensation failed", func(t *testing.T) {
+		t.Parallel()
+
+		journal := &testRecorder[string]{}
+		refundErr := errors.New("refund failed")
+
+		var refunds int
+
+		err := NewSaga().
+			SetCompensationRetries(2, time.Millisecond).
+			Step("reserve", recordingStep(journal, "reserve", nil), func(context.Context) error {
+				panic("release failed")
+			}).
+			Step("charge", recordingStep(journal, "charge", nil), func(context.Context) error {
+				refunds++
+				return refundErr
+			}).
+			Step("ship", func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}, nil, WithContextTimeout(10*time.Millisecond)).
+			Run(context.Background())
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.ErrorIs(t, err, refundErr)
+		assert.Equal(t, 3, refunds)
+
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+		assert.Equal(t, "release failed", panicErr.Value)
+
+		var sagaErr *SagaError
+		require.ErrorAs(t, err, &sagaErr)
+		assert.Equal(t, "ship", sagaErr.Step)
+		assert.Empty(t, sagaErr.Compensated)
+		require.Len(t, sagaErr.CompensationErrs, 2)
+		assert.Equal(t, "charge", sagaErr.CompensationErrs[0].Step)
+		assert.Equal(t, "reserve", sagaErr.CompensationErrs[1].Step)
+		assert.Equal(t, "saga: step 'ship' failed: context deadline exceeded; compensation of step 'charge' failed: refund failed; compensation of step 'reserve' failed: panic: release failed", err.Error())
+	})
+
+	t.Run("Timed out", func(t *testing.T) {
+		t.Parallel()
+
+		journal := &testRecorder[string]{}
+
+		err := NewSaga().
+			Step("reserve", recordingStep(journal, "reserve", nil), recordingStep(journal, "release", nil)).
+			Step("charge", func(context.Context) error {
+				// ignores the context, and goes through late
+				time.Sleep(50 * time.Millisecond)
+
+				return recordingStep(journal, "charge", nil)(context.Background())
+			}, recordingStep(journal, "refund", nil), WithContextTimeout(10*time.Millisecond)).
+			Run(context.Background())
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// the late charge is refunded after it goes through
+		assert.Equal(t, []string{"reserve", "charge", "refund", "release"}, journal.snapshot())
+
+		var sagaErr *SagaError
+		require.ErrorAs(t, err, &sagaErr)
+		assert.Equal(t, "charge", sagaErr.Step)
+		assert.Equal(t, []string{"charge", "reserve"}, sagaErr.Compensated)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		t.Parallel()
+
+		journal := &testRecorder[string]{}
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		err := NewSaga().
+			Step("reserve", func(context.Context) error {
+				cancel()
+				return nil
+			}, func(ctx context.Context) error {
+				return ctx.Err()
+			}).
+			Step("charge", recordingStep(journal, "charge", nil), nil).
+			Run(ctx)
+		require.ErrorIs(t, err, context.Canceled)
+
+		var sagaErr *SagaError
+		require.ErrorAs(t, err, &sagaErr)
+		assert.Equal(t, "charge", sagaErr.Step)
+		assert.Equal(t, []string{"reserve"}, sagaErr.Compensated)
+		assert.Empty(t, journal.snapshot())
+	})
+
+	t.Run("Registry", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewRegistry()
+		r.Set("test.saga.reserve.compensate", Policy{Retries: 2})
+
+		var releases int
+
+		err := NewSaga().
+			Step("test.saga.reserve", func(context.Context) error {
+				return nil
+			}, func(context.Context) error {
+				releases++
+				if releases < 3 {
+					return assert.AnError
+				}
+
+				return nil
+			}, WithRegistry(r)).
+			Step("test.saga.charge", func(context.Context) error {
+				return assert.AnError
+			}, nil, WithRegistry(r)).
+			Run(context.Background())
+		require.ErrorIs(t, err, assert.AnError)
+		assert.Equal(t, 3, releases)
+
+		var sagaErr *SagaError
+		require.ErrorAs(t, err, &sagaErr)
+		assert.Equal(t, []string{"test.saga.reserve"}, sagaErr.Compensated)
+	})
+}
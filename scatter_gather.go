@@ -0,0 +1,134 @@
+package fo
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// ScatterGatherResult is the results of ScatterGather(...) by the index
+// of the shard.
+type ScatterGatherResult[R any] struct {
+	// Results are the results of the shards returned without error before
+	// the deadline.
+	Results map[int]R
+	// Errs are the errors of the shards returned with error, panicked, or
+	// not returned before the deadline.
+	Errs map[int]error
+}
+
+// Complete reports whether all the shards returned without error.
+func (r ScatterGatherResult[R]) Complete() bool {
+	return len(r.Errs) == 0
+}
+
+// scatterGather collects the results of the shards, every shard is
+// settled exactly once, either by the outcome of its invocation or by the
+// deadline.
+type scatterGather[R any] struct {
+	settled []atomic.Bool
+	done    chan struct{}
+
+	mutex   sync.Mutex
+	result  ScatterGatherResult[R]
+	pending int
+}
+
+// settle records the result of the shard if it is not settled yet, and
+// reports whether it is recorded.
+func (g *scatterGather[R]) settle(shard int, res R, err error) bool {
+	if !g.settled[shard].CompareAndSwap(false, true) {
+		return false
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if err != nil {
+		g.result.Errs[shard] = err
+	} else {
+		g.result.Results[shard] = res
+	}
+
+	g.pending--
+	if g.pending == 0 {
+		close(g.done)
+	}
+
+	return true
+}
+
+// ScatterGather invokes all the callback functions concurrently with the
+// call options applied, e.g. the queries of the search shards, and returns
+// whatever results arrived before ctx is done together with the errors of
+// the rest of the shards, instead of failing the whole fan-out. It
+// returns as soon as all the shards return, or ctx is done, in which case
+// the shards not returned yet fail with the error of ctx.
+//
+// Every shard is settled by the final outcome of its invocation, so that
+// the failed attempts retried by the policy in the registry do not fail
+// the shard. The callback functions still running after their shards are
+// failed, e.g. by ctx or by WithContextTimeout(...), are reported to late
+// with their results once they return, late can be nil.
+//
+//	res := fo.ScatterGather(ctx, shards, func(shard int, hits []Hit, err error) {
+//		logger.Warn("shard returned late", zap.Int("shard", shard), zap.Error(err))
+//	}, fo.WithContextTimeout(200*time.Millisecond))
+//	if !res.Complete() {
+//		// res.Errs: errors by shard
+//	}
+func ScatterGather[R any](ctx context.Context, fns []func(ctx context.Context) (R, error), late func(shard int, res R, err error), opts ...CallInvokeWithOption) ScatterGatherResult[R] {
+	g := &scatterGather[R]{
+		settled: make([]atomic.Bool, len(fns)),
+		done:    make(chan struct{}),
+		result: ScatterGatherResult[R]{
+			Results: make(map[int]R),
+			Errs:    make(map[int]error),
+		},
+		pending: len(fns),
+	}
+	if len(fns) == 0 {
+		return g.result
+	}
+
+	for shard, fn := range fns {
+		go func() {
+			var res R
+
+			err := callWithPanicRecovery(func() error {
+				var err error
+				res, err = InvokeWithContext(ctx, func(ctx context.Context) (R, error) {
+					shardRes, shardErr := fn(ctx)
+					// the attempts returned before the shard is settled are
+					// part of the invocation, e.g. retried or returned in
+					// time, and the ones after are the abandoned stragglers
+					if g.settled[shard].Load() && late != nil {
+						late(shard, shardRes, shardErr)
+					}
+
+					return shardRes, shardErr
+				}, opts...)
+
+				return err
+			})
+
+			g.settle(shard, res, err)
+		}()
+	}
+
+	select {
+	case <-g.done:
+	case <-ctx.Done():
+		var empty R
+
+		err := contextError(ctx)
+		for shard := range fns {
+			g.settle(shard, empty, err)
+		}
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.result
+}
@@ -0,0 +1,134 @@
+package fo
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScatterGather(t *testing.T) {
+	t.Parallel()
+
+	shard := func(res int, err error, delay time.Duration) func(ctx context.Context) (int, error) {
+		return func(ctx context.Context) (int, error) {
+			time.Sleep(delay)
+			return res, err
+		}
+	}
+
+	t.Run("Complete", func(t *testing.T) {
+		t.Parallel()
+
+		res := ScatterGather(context.Background(), []func(ctx context.Context) (int, error){
+			shard(1, nil, 0),
+			shard(2, nil, 10*time.Millisecond),
+			shard(3, nil, 0),
+		}, nil)
+		assert.True(t, res.Complete())
+		assert.Equal(t, map[int]int{0: 1, 1: 2, 2: 3}, res.Results)
+		assert.Empty(t, res.Errs)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		t.Parallel()
+
+		res := ScatterGather[int](context.Background(), nil, nil)
+		assert.True(t, res.Complete())
+		assert.Empty(t, res.Results)
+	})
+
+	t.Run("Partial", func(t *testing.T) {
+		t.Parallel()
+
+		errShard := errors.New("shard unavailable")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		type lateResult struct {
+			shard int
+			res   int
+			err   error
+		}
+
+		lateChan := make(chan lateResult, 1)
+
+		start := time.Now()
+
+		res := ScatterGather(ctx, []func(ctx context.Context) (int, error){
+			shard(1, nil, 0),
+			shard(0, errShard, 0),
+			shard(3, nil, 200*time.Millisecond),
+			func(ctx context.Context) (int, error) { panic("boom") },
+		}, func(shard int, res int, err error) {
+			lateChan <- lateResult{shard: shard, res: res, err: err}
+		})
+		assert.Less(t, time.Since(start), 150*time.Millisecond)
+
+		assert.False(t, res.Complete())
+		assert.Equal(t, map[int]int{0: 1}, res.Results)
+		require.Len(t, res.Errs, 3)
+		require.ErrorIs(t, res.Errs[1], errShard)
+		require.ErrorIs(t, res.Errs[2], context.DeadlineExceeded)
+
+		var panicErr *PanicError
+		require.ErrorAs(t, res.Errs[3], &panicErr)
+
+		select {
+		case late := <-lateChan:
+			assert.Equal(t, lateResult{shard: 2, res: 3}, late)
+		case <-time.After(time.Second):
+			require.FailNow(t, "the straggler is not reported")
+		}
+	})
+
+	t.Run("ShardTimeout", func(t *testing.T) {
+		t.Parallel()
+
+		lateChan := make(chan int, 1)
+
+		res := ScatterGather(context.Background(), []func(ctx context.Context) (int, error){
+			shard(1, nil, 0),
+			shard(2, nil, 100*time.Millisecond),
+		}, func(shard int, res int, err error) {
+			lateChan <- shard
+		}, WithContextTimeout(20*time.Millisecond))
+		assert.Equal(t, map[int]int{0: 1}, res.Results)
+		require.ErrorIs(t, res.Errs[1], context.DeadlineExceeded)
+
+		select {
+		case shard := <-lateChan:
+			assert.Equal(t, 1, shard)
+		case <-time.After(time.Second):
+			require.FailNow(t, "the straggler is not reported")
+		}
+	})
+	t.Run("Retried", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewRegistry()
+		r.Set("test.scatter.retried", Policy{Retries: 1})
+
+		var attempts atomic.Int32
+
+		res := ScatterGather(context.Background(), []func(ctx context.Context) (int, error){
+			func(ctx context.Context) (int, error) {
+				if attempts.Add(1) == 1 {
+					return 0, errors.New("transient")
+				}
+
+				return 1, nil
+			},
+		}, func(shard int, res int, err error) {
+			assert.Fail(t, "the retried shard is reported late")
+		}, WithName("test.scatter.retried"), WithRegistry(r))
+		assert.True(t, res.Complete())
+		assert.Equal(t, map[int]int{0: 1}, res.Results)
+		assert.Equal(t, int32(2), attempts.Load())
+	})
+}
@@ -0,0 +1,376 @@
+package fo
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrSchedulerQueueFull is the error returned by the invocations
+	// scheduled with WithScheduler(...) when the queue of the tenant is
+	// full.
+	ErrSchedulerQueueFull = errors.New("fo: scheduler queue is full")
+)
+
+// TenantQuota is the quota of a tenant of Scheduler.
+type TenantQuota struct {
+	// Weight is the weight of the fair share of the global pool, the
+	// tenants get the freed slots in proportion to their weights when
+	// they compete for them. Defaults to 1.
+	Weight int
+	// MaxConcurrency limits the number of the running invocations of the
+	// tenant if positive.
+	MaxConcurrency int
+	// MaxQueued limits the number of the invocations of the tenant waiting
+	// for slots if positive, the exceeded ones are rejected with
+	// ErrSchedulerQueueFull.
+	MaxQueued int
+}
+
+// TenantStats is the statistics of a tenant of Scheduler.
+type TenantStats struct {
+	// Queued is the number of the invocations waiting for slots.
+	Queued int
+	// Running is the number of the invocations holding slots.
+	Running int
+	// Admitted is the total number of the invocations that got slots.
+	Admitted uint64
+	// Rejected is the total number of the invocations rejected for the
+	// queue being full.
+	Rejected uint64
+	// Expired is the total number of the invocations that left the queue
+	// for their contexts being done.
+	Expired uint64
+}
+
+// schedulerWaiter is an invocation waiting for a slot.
+type schedulerWaiter struct {
+	seq     uint64
+	granted chan struct{}
+}
+
+// schedulerTenant is the runtime state of a tenant.
+type schedulerTenant struct {
+	name  string
+	quota TenantQuota
+	// custom reports whether the quota is set by SetTenant(...) instead of
+	// the default one.
+	custom bool
+	queue  []*schedulerWaiter
+	stats  TenantStats
+	// index is the index of the tenant in the eligible heap, or -1 if not
+	// eligible.
+	index int
+}
+
+// eligible reports whether the tenant is waiting for a slot and is still
+// under its own quota.
+func (t *schedulerTenant) eligible() bool {
+	return len(t.queue) > 0 && (t.quota.MaxConcurrency <= 0 || t.stats.Running < t.quota.MaxConcurrency)
+}
+
+// idle reports whether the tenant has the default quota and neither
+// queued nor running invocations, so that it can be dropped.
+func (t *schedulerTenant) idle() bool {
+	return !t.custom && len(t.queue) == 0 && t.stats.Running == 0
+}
+
+// eligibleTenants is a heap of the eligible tenants ordered by the least
+// running invocations per weight, and by the one waiting the longest on
+// ties.
+type eligibleTenants []*schedulerTenant
+
+func (h eligibleTenants) Len() int { return len(h) }
+
+func (h eligibleTenants) Less(i, j int) bool {
+	// compares running/weight without division
+	share := h[i].stats.Running * h[j].quota.Weight
+	otherShare := h[j].stats.Running * h[i].quota.Weight
+
+	return share < otherShare || (share == otherShare && h[i].queue[0].seq < h[j].queue[0].seq)
+}
+
+func (h eligibleTenants) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *eligibleTenants) Push(x any) {
+	tenant, _ := x.(*schedulerTenant)
+	tenant.index = len(*h)
+	*h = append(*h, tenant)
+}
+
+func (h *eligibleTenants) Pop() any {
+	old := *h
+	tenant := old[len(old)-1]
+	old[len(old)-1] = nil
+	tenant.index = -1
+	*h = old[:len(old)-1]
+
+	return tenant
+}
+
+// Scheduler schedules the invocations of multiple tenants onto a global
+// pool of slots, with a concurrency quota for each tenant and the freed
+// slots shared among the waiting tenants in proportion to their weights,
+// so that a noisy tenant cannot starve the others.
+//
+// The invocations wait for slots with the timeouts set by the call
+// options or the policies, and hold the slots until the callback functions
+// return. The tenants with the default quota are dropped once they have
+// neither queued nor running invocations, so that only the cumulative
+// statistics are kept for every tenant ever seen.
+//
+//	scheduler := fo.NewScheduler(100).
+//		SetTenant("enterprise", fo.TenantQuota{Weight: 4, MaxConcurrency: 50}).
+//		SetDefaultQuota(fo.TenantQuota{Weight: 1, MaxConcurrency: 10, MaxQueued: 100})
+//
+//	res, err := fo.InvokeWith(query, fo.WithScheduler(scheduler, tenantID), fo.WithContextTimeout(time.Second))
+type Scheduler struct {
+	capacity int
+
+	mutex        sync.Mutex
+	running      int
+	seq          uint64
+	defaultQuota TenantQuota
+	tenants      map[string]*schedulerTenant
+	eligible     eligibleTenants
+	// idle is the statistics of the tenants dropped while idle.
+	idle map[string]TenantStats
+}
+
+// NewScheduler creates a new Scheduler with the number of the slots of the
+// global pool.
+func NewScheduler(capacity int) *Scheduler {
+	return &Scheduler{
+		capacity:     capacity,
+		defaultQuota: TenantQuota{Weight: 1},
+		tenants:      make(map[string]*schedulerTenant),
+		eligible:     make(eligibleTenants, 0),
+		idle:         make(map[string]TenantStats),
+	}
+}
+
+// SetTenant sets the quota of the tenant.
+func (s *Scheduler) SetTenant(tenant string, quota TenantQuota) *Scheduler {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state := s.tenant(tenant)
+	state.quota = normalizeTenantQuota(quota)
+	state.custom = true
+
+	s.update(state)
+	s.dispatch()
+
+	return s
+}
+
+// SetDefaultQuota sets the quota of the tenants not set by SetTenant(...),
+// which defaults to the weight of 1 without any limits.
+func (s *Scheduler) SetDefaultQuota(quota TenantQuota) *Scheduler {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.defaultQuota = normalizeTenantQuota(quota)
+
+	for _, tenant := range s.tenants {
+		if !tenant.custom {
+			tenant.quota = s.defaultQuota
+			s.update(tenant)
+		}
+	}
+
+	s.dispatch()
+
+	return s
+}
+
+// Stats returns the statistics of all the tenants that have been
+// scheduled or set.
+func (s *Scheduler) Stats() map[string]TenantStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := make(map[string]TenantStats, len(s.tenants)+len(s.idle))
+	for name, tenantStats := range s.idle {
+		stats[name] = tenantStats
+	}
+
+	for name, tenant := range s.tenants {
+		tenantStats := tenant.stats
+		tenantStats.Queued = len(tenant.queue)
+		stats[name] = tenantStats
+	}
+
+	return stats
+}
+
+func normalizeTenantQuota(quota TenantQuota) TenantQuota {
+	if quota.Weight <= 0 {
+		quota.Weight = 1
+	}
+
+	return quota
+}
+
+// tenant returns the state of the tenant, and creates it with the default
+// quota and the statistics kept while idle if not exists, must be called
+// with the mutex held.
+func (s *Scheduler) tenant(name string) *schedulerTenant {
+	tenant, ok := s.tenants[name]
+	if !ok {
+		tenant = &schedulerTenant{
+			name:  name,
+			quota: s.defaultQuota,
+			queue: make([]*schedulerWaiter, 0),
+			stats: s.idle[name],
+			index: -1,
+		}
+		s.tenants[name] = tenant
+		delete(s.idle, name)
+	}
+
+	return tenant
+}
+
+// acquire waits for a slot for the tenant until ctx is done, and returns
+// the function to release the slot.
+func (s *Scheduler) acquire(ctx context.Context, name string) (func(), error) {
+	s.mutex.Lock()
+
+	tenant := s.tenant(name)
+	release := func() {
+		s.release(tenant)
+	}
+
+	if len(tenant.queue) == 0 && s.running < s.capacity &&
+		(tenant.quota.MaxConcurrency <= 0 || tenant.stats.Running < tenant.quota.MaxConcurrency) {
+		s.admit(tenant)
+		s.mutex.Unlock()
+
+		return release, nil
+	}
+	if tenant.quota.MaxQueued > 0 && len(tenant.queue) >= tenant.quota.MaxQueued {
+		tenant.stats.Rejected++
+		s.mutex.Unlock()
+
+		return nil, ErrSchedulerQueueFull
+	}
+
+	s.seq++
+	waiter := &schedulerWaiter{
+		seq:     s.seq,
+		granted: make(chan struct{}),
+	}
+	tenant.queue = append(tenant.queue, waiter)
+	s.update(tenant)
+
+	s.mutex.Unlock()
+
+	select {
+	case <-waiter.granted:
+		return release, nil
+	case <-ctx.Done():
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tenant.stats.Expired++
+
+	select {
+	case <-waiter.granted:
+		// the slot is granted at the same time, hand it over
+		s.releaseLocked(tenant)
+	default:
+		for i, queued := range tenant.queue {
+			if queued == waiter {
+				tenant.queue = append(tenant.queue[:i], tenant.queue[i+1:]...)
+				break
+			}
+		}
+
+		s.update(tenant)
+	}
+
+	return nil, contextError(ctx)
+}
+
+// admit counts a slot as held by the tenant, must be called with the
+// mutex held.
+func (s *Scheduler) admit(tenant *schedulerTenant) {
+	s.running++
+	tenant.stats.Running++
+	tenant.stats.Admitted++
+}
+
+func (s *Scheduler) release(tenant *schedulerTenant) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.releaseLocked(tenant)
+}
+
+func (s *Scheduler) releaseLocked(tenant *schedulerTenant) {
+	s.running--
+	tenant.stats.Running--
+	s.update(tenant)
+	s.dispatch()
+}
+
+// update moves the tenant into or out of the eligible heap, or drops it
+// with only the statistics kept if idle, after its state changes, must be
+// called with the mutex held.
+func (s *Scheduler) update(tenant *schedulerTenant) {
+	switch {
+	case tenant.eligible() && tenant.index >= 0:
+		heap.Fix(&s.eligible, tenant.index)
+	case tenant.eligible():
+		heap.Push(&s.eligible, tenant)
+	case tenant.index >= 0:
+		heap.Remove(&s.eligible, tenant.index)
+	}
+
+	if tenant.idle() {
+		s.idle[tenant.name] = tenant.stats
+		delete(s.tenants, tenant.name)
+	}
+}
+
+// dispatch grants the free slots to the waiting tenants, must be called
+// with the mutex held. Every slot goes to the eligible tenant with the
+// least running invocations per weight, and to the one waiting the
+// longest on ties.
+func (s *Scheduler) dispatch() {
+	for s.running < s.capacity && len(s.eligible) > 0 {
+		next := s.eligible[0]
+
+		waiter := next.queue[0]
+		next.queue = next.queue[1:]
+
+		s.admit(next)
+		s.update(next)
+		close(waiter.granted)
+	}
+}
+
+// WithScheduler schedules the invocation with the scheduler as the
+// tenant, the invocation waits for a slot of the tenant with the timeout
+// set by the call options or the policy.
+func WithScheduler(scheduler *Scheduler, tenant string) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeScheduler,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				scheduler:      scheduler,
+				tenant:         tenant,
+				schedulerIsSet: true,
+			}
+		},
+	}
+}
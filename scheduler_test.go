@@ -0,0 +1,385 @@
+package fo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *Scheduler) queued(tenant string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, ok := s.tenants[tenant]
+	if !ok {
+		return 0
+	}
+
+	return len(state.queue)
+}
+
+func TestScheduler(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Fair", func(t *testing.T) {
+		t.Parallel()
+
+		scheduler := NewScheduler(2)
+
+		var mutex sync.Mutex
+
+		order := make([]string, 0)
+		release := make(chan struct{})
+
+		var wg sync.WaitGroup
+
+		run := func(tenant string) {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				err := InvokeWith0(func() error {
+					mutex.Lock()
+					order = append(order, tenant)
+					mutex.Unlock()
+
+					<-release
+
+					return nil
+				}, WithScheduler(scheduler, tenant))
+				assert.NoError(t, err)
+			}()
+		}
+
+		// the noisy tenant takes the whole pool and queues more calls
+		// before the quiet one
+		for range 6 {
+			run("noisy")
+		}
+
+		for scheduler.queued("noisy") < 4 {
+			time.Sleep(time.Millisecond)
+		}
+
+		run("quiet")
+
+		for scheduler.queued("quiet") < 1 {
+			time.Sleep(time.Millisecond)
+		}
+
+		stats := scheduler.Stats()
+		assert.Equal(t, TenantStats{Queued: 4, Running: 2, Admitted: 2}, stats["noisy"])
+		assert.Equal(t, TenantStats{Queued: 1}, stats["quiet"])
+
+		// the quiet tenant gets the first freed slot
+		release <- struct{}{}
+
+		for {
+			mutex.Lock()
+			started := len(order)
+			mutex.Unlock()
+
+			if started == 3 {
+				break
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+
+		mutex.Lock()
+		assert.Equal(t, "quiet", order[2])
+		mutex.Unlock()
+
+		close(release)
+		wg.Wait()
+
+		// the statistics are kept after the idle tenants are dropped
+		stats = scheduler.Stats()
+		assert.Equal(t, TenantStats{Admitted: 6}, stats["noisy"])
+		assert.Equal(t, TenantStats{Admitted: 1}, stats["quiet"])
+	})
+
+	t.Run("Weighted", func(t *testing.T) {
+		t.Parallel()
+
+		scheduler := NewScheduler(4).
+			SetTenant("gold", TenantQuota{Weight: 3})
+
+		release := make(chan struct{})
+		blocked := make(chan struct{})
+
+		var wg sync.WaitGroup
+
+		// occupies the whole pool so that the calls below are queued
+		for range 4 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_ = InvokeWith0(func() error {
+					<-blocked
+					return nil
+				}, WithScheduler(scheduler, "blocker"))
+			}()
+		}
+
+		for scheduler.Stats()["blocker"].Running < 4 {
+			time.Sleep(time.Millisecond)
+		}
+
+		var gold, silver atomic.Int32
+
+		for i := range 8 {
+			tenant, counter := "gold", &gold
+			if i%2 == 1 {
+				tenant, counter = "silver", &silver
+			}
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_ = InvokeWith0(func() error {
+					counter.Add(1)
+					<-release
+
+					return nil
+				}, WithScheduler(scheduler, tenant))
+			}()
+		}
+
+		for scheduler.queued("gold")+scheduler.queued("silver") < 8 {
+			time.Sleep(time.Millisecond)
+		}
+
+		close(blocked)
+
+		for gold.Load()+silver.Load() < 4 {
+			time.Sleep(time.Millisecond)
+		}
+
+		// the freed slots are shared 3:1
+		assert.Equal(t, int32(3), gold.Load())
+		assert.Equal(t, int32(1), silver.Load())
+
+		close(release)
+		wg.Wait()
+	})
+
+	t.Run("Quota", func(t *testing.T) {
+		t.Parallel()
+
+		scheduler := NewScheduler(10).
+			SetDefaultQuota(TenantQuota{MaxConcurrency: 1, MaxQueued: 1})
+
+		release := make(chan struct{})
+
+		var wg sync.WaitGroup
+
+		for range 2 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				err := InvokeWith0(func() error {
+					<-release
+					return nil
+				}, WithScheduler(scheduler, "tenant-1"))
+				assert.NoError(t, err)
+			}()
+		}
+
+		for scheduler.queued("tenant-1") < 1 {
+			time.Sleep(time.Millisecond)
+		}
+
+		err := InvokeWith0(func() error {
+			return nil
+		}, WithScheduler(scheduler, "tenant-1"))
+		require.ErrorIs(t, err, ErrSchedulerQueueFull)
+
+		// the other tenants are not affected
+		err = InvokeWith0(func() error {
+			return nil
+		}, WithScheduler(scheduler, "tenant-2"))
+		require.NoError(t, err)
+
+		assert.Equal(t, TenantStats{Queued: 1, Running: 1, Admitted: 1, Rejected: 1}, scheduler.Stats()["tenant-1"])
+
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, TenantStats{Admitted: 2, Rejected: 1}, scheduler.Stats()["tenant-1"])
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		t.Parallel()
+
+		scheduler := NewScheduler(1)
+		release := make(chan struct{})
+		started := make(chan struct{})
+
+		go func() {
+			_ = InvokeWith0(func() error {
+				close(started)
+				<-release
+
+				return nil
+			}, WithScheduler(scheduler, "tenant-1"))
+		}()
+
+		<-started
+
+		var calls atomic.Int32
+
+		err := InvokeWith0(func() error {
+			calls.Add(1)
+			return nil
+		}, WithScheduler(scheduler, "tenant-1"), WithContextTimeout(10*time.Millisecond))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Zero(t, calls.Load())
+		assert.Equal(t, TenantStats{Running: 1, Admitted: 1, Expired: 1}, scheduler.Stats()["tenant-1"])
+
+		close(release)
+
+		for scheduler.Stats()["tenant-1"].Running > 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		assert.Equal(t, TenantStats{Admitted: 1, Expired: 1}, scheduler.Stats()["tenant-1"])
+	})
+
+	t.Run("Abandoned", func(t *testing.T) {
+		t.Parallel()
+
+		scheduler := NewScheduler(1)
+
+		err := InvokeWith0(func() error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}, WithScheduler(scheduler, "tenant-1"), WithContextTimeout(10*time.Millisecond))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// the slot is held until the abandoned callback function returns
+		assert.Equal(t, 1, scheduler.Stats()["tenant-1"].Running)
+
+		err = InvokeWith0(func() error {
+			return nil
+		}, WithScheduler(scheduler, "tenant-1"), WithContextTimeout(time.Second))
+		require.NoError(t, err)
+	})
+
+	t.Run("Breaker", func(t *testing.T) {
+		t.Parallel()
+
+		registry := NewRegistry()
+		registry.Set("test.scheduler.breaker", Policy{
+			Breaker: &BreakerPolicy{FailureThreshold: 1, OpenDuration: Duration(10 * time.Millisecond)},
+		})
+
+		scheduler := NewScheduler(1)
+
+		invoke := func(fn func() error, timeout time.Duration) error {
+			return InvokeWith0(fn, WithName("test.scheduler.breaker"), WithRegistry(registry), WithScheduler(scheduler, "tenant-1"), WithContextTimeout(timeout))
+		}
+
+		// opens the breaker
+		err := invoke(func() error {
+			return assert.AnError
+		}, time.Second)
+		require.ErrorIs(t, err, assert.AnError)
+
+		release := make(chan struct{})
+		started := make(chan struct{})
+
+		go func() {
+			_ = InvokeWith0(func() error {
+				close(started)
+				<-release
+
+				return nil
+			}, WithScheduler(scheduler, "tenant-2"))
+		}()
+
+		<-started
+		time.Sleep(20 * time.Millisecond)
+
+		// the trial call times out while waiting for the slot
+		err = invoke(func() error {
+			return nil
+		}, 10*time.Millisecond)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		close(release)
+
+		// the breaker lets the next trial call through instead of being
+		// stuck in half-open
+		err = invoke(func() error {
+			return nil
+		}, time.Second)
+		require.NoError(t, err)
+	})
+
+	t.Run("ShuttingDown", func(t *testing.T) {
+		t.Parallel()
+
+		scheduler := NewScheduler(1)
+		tracker := NewTracker(0)
+
+		_, err := tracker.Shutdown(context.Background())
+		require.NoError(t, err)
+
+		err = InvokeWith0(func() error {
+			return nil
+		}, WithScheduler(scheduler, "tenant-1"), WithTracker(tracker))
+		require.ErrorIs(t, err, ErrShuttingDown)
+		assert.Zero(t, scheduler.Stats()["tenant-1"].Running)
+	})
+	t.Run("Idle", func(t *testing.T) {
+		t.Parallel()
+
+		scheduler := NewScheduler(1).
+			SetTenant("custom", TenantQuota{Weight: 2})
+
+		for i := range 100 {
+			err := InvokeWith0(func() error {
+				return nil
+			}, WithScheduler(scheduler, fmt.Sprintf("tenant-%d", i)))
+			require.NoError(t, err)
+		}
+
+		err := InvokeWith0(func() error {
+			return nil
+		}, WithScheduler(scheduler, "custom"))
+		require.NoError(t, err)
+
+		// only the statistics of the idle tenants are kept, except for the
+		// ones set by SetTenant(...)
+		scheduler.mutex.Lock()
+		assert.Len(t, scheduler.tenants, 1)
+		assert.Empty(t, scheduler.eligible)
+		scheduler.mutex.Unlock()
+
+		stats := scheduler.Stats()
+		assert.Len(t, stats, 101)
+		assert.Equal(t, TenantStats{Admitted: 1}, stats["custom"])
+		assert.Equal(t, TenantStats{Admitted: 1}, stats["tenant-42"])
+
+		// the statistics are restored once the tenant is scheduled again
+		err = InvokeWith0(func() error {
+			return nil
+		}, WithScheduler(scheduler, "tenant-42"))
+		require.NoError(t, err)
+		assert.Equal(t, TenantStats{Admitted: 2}, scheduler.Stats()["tenant-42"])
+	})
+}
@@ -0,0 +1,325 @@
+package fo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTooManyRestarts is the error returned by Supervisor.Run(...) when
+	// the workers are restarted more than the max restarts within the
+	// window.
+	ErrTooManyRestarts = errors.New("fo: too many restarts")
+)
+
+const (
+	defaultSupervisorMaxRestarts = 3
+	defaultSupervisorWindow      = 5 * time.Second
+	defaultSupervisorMinBackoff  = 100 * time.Millisecond
+	defaultSupervisorMaxBackoff  = 10 * time.Second
+)
+
+// SupervisorStrategy is the strategy of Supervisor to restart the workers.
+type SupervisorStrategy int
+
+const (
+	// OneForOne restarts only the failed worker.
+	OneForOne SupervisorStrategy = iota
+	// OneForAll stops all the other workers once a worker fails, and then
+	// restarts all of them.
+	OneForAll
+)
+
+// supervisedWorker is a worker added to Supervisor.
+type supervisedWorker struct {
+	name   string
+	worker func(ctx context.Context) error
+	opts   []CallInvokeWithOption
+	// turn is held by the run of the worker until it exits, so that a
+	// restarted run never overlaps with the abandoned one.
+	turn chan struct{}
+}
+
+// Supervisor runs the long-running workers and restarts them when they
+// fail or panic, in the style of the Erlang supervisors.
+//
+// Every run of the workers is invoked with InvokeWithContext0(...) and is
+// named after the worker, so that the options like WithContextTimeout(...)
+// and the policies in the registry apply, and panics are recovered as
+// *PanicError. A worker returning nil is considered done and will not be
+// restarted, while a worker returning error or panicking is restarted
+// according to the strategy, after an exponential backoff. The failures
+// are passed to the handlers registered by Use(...).
+//
+// A run of the worker that ignores its context is abandoned rather than
+// stopped when it times out or is stopped by OneForAll, the restarted run
+// waits for it to exit before calling the worker, so that two runs of the
+// same worker never overlap.
+//
+// Run returns ErrTooManyRestarts once the workers are restarted more than
+// the max restarts within the window, which defaults to 3 restarts in 5
+// seconds, set by SetMaxRestarts(...).
+//
+//	err := fo.NewSupervisor(fo.OneForOne).
+//		Use(fo.WithLoggerHandler(logger)).
+//		Add("consumer", consume).
+//		Add("janitor", cleanUp, fo.WithContextTimeout(time.Minute)).
+//		Run(ctx)
+type Supervisor struct {
+	*mayHandlers
+
+	strategy    SupervisorStrategy
+	maxRestarts int
+	window      time.Duration
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	workers     []*supervisedWorker
+
+	restartsMutex sync.Mutex
+	restarts      []time.Time
+}
+
+// NewSupervisor creates a new Supervisor with the strategy.
+func NewSupervisor(strategy SupervisorStrategy) *Supervisor {
+	return &Supervisor{
+		mayHandlers: newMayHandlers(),
+		strategy:    strategy,
+		maxRestarts: defaultSupervisorMaxRestarts,
+		window:      defaultSupervisorWindow,
+		minBackoff:  defaultSupervisorMinBackoff,
+		maxBackoff:  defaultSupervisorMaxBackoff,
+		workers:     make([]*supervisedWorker, 0),
+		restarts:    make([]time.Time, 0),
+	}
+}
+
+// Use registers the handlers that handle the failures of the workers.
+func (s *Supervisor) Use(handler ...MayHandler) *Supervisor {
+	s.mayHandlers.Use(handler...)
+	return s
+}
+
+// SetMaxRestarts sets the max number of restarts of all the workers
+// within the window, a negative maxRestarts indicates no limit.
+func (s *Supervisor) SetMaxRestarts(maxRestarts int, window time.Duration) *Supervisor {
+	s.maxRestarts = maxRestarts
+	s.window = window
+
+	return s
+}
+
+// SetBackoff sets the backoff before restarting the failed workers, which
+// starts from minBackoff and doubles on every consecutive failure up to
+// maxBackoff. The consecutive failures are reset once the workers run
+// longer than the window set by SetMaxRestarts(...) before failing.
+func (s *Supervisor) SetBackoff(minBackoff, maxBackoff time.Duration) *Supervisor {
+	s.minBackoff = minBackoff
+	s.maxBackoff = maxBackoff
+
+	return s
+}
+
+// Add adds a worker with the name and the options to invoke it with. The
+// workers must be added before Run is called.
+func (s *Supervisor) Add(name string, worker func(ctx context.Context) error, opts ...CallInvokeWithOption) *Supervisor {
+	s.workers = append(s.workers, &supervisedWorker{
+		name:   name,
+		worker: worker,
+		opts:   append([]CallInvokeWithOption{WithName(name)}, opts...),
+		turn:   make(chan struct{}, 1),
+	})
+
+	return s
+}
+
+// Run runs the workers and supervises them until ctx is done, all of the
+// workers are done, or the workers are restarted too many times. It
+// returns nil in the first two cases, and ErrTooManyRestarts wrapping the
+// last failure in the last case after all the workers are stopped.
+func (s *Supervisor) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	if s.strategy == OneForAll {
+		s.runOneForAll(ctx, cancel)
+	} else {
+		s.runOneForOne(ctx, cancel)
+	}
+
+	cause := context.Cause(ctx)
+	if errors.Is(cause, ErrTooManyRestarts) {
+		return cause
+	}
+
+	return nil
+}
+
+func (s *Supervisor) runOneForOne(ctx context.Context, cancel context.CancelCauseFunc) {
+	var wg sync.WaitGroup
+
+	for _, worker := range s.workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for failures := 1; ; failures++ {
+				start := time.Now()
+
+				err := s.runWorker(ctx, worker)
+				if err == nil || ctx.Err() != nil {
+					return
+				}
+				if time.Since(start) >= s.window {
+					failures = 1
+				}
+				if !s.restart(ctx, cancel, worker, err, failures) {
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (s *Supervisor) runOneForAll(ctx context.Context, cancel context.CancelCauseFunc) {
+	done := make([]bool, len(s.workers))
+
+	for failures := 1; ; failures++ {
+		start := time.Now()
+
+		var wg sync.WaitGroup
+		var failedOnce sync.Once
+		var failed *supervisedWorker
+		var failedErr error
+
+		workersCtx, cancelWorkers := context.WithCancel(ctx)
+
+		for i, worker := range s.workers {
+			if done[i] {
+				continue
+			}
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				err := s.runWorker(workersCtx, worker)
+				if workersCtx.Err() != nil {
+					return
+				}
+				if err == nil {
+					done[i] = true
+					return
+				}
+
+				failedOnce.Do(func() {
+					failed, failedErr = worker, err
+					cancelWorkers()
+				})
+			}()
+		}
+
+		wg.Wait()
+		cancelWorkers()
+
+		if failed == nil || ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) >= s.window {
+			failures = 1
+		}
+		if !s.restart(ctx, cancel, failed, failedErr, failures) {
+			return
+		}
+	}
+}
+
+// runWorker runs the worker once and recovers the panic as *PanicError.
+// The worker is called once the previous run of it exits.
+func (s *Supervisor) runWorker(ctx context.Context, worker *supervisedWorker) error {
+	return callWithPanicRecovery(func() error {
+		return InvokeWithContext0(ctx, func(ctx context.Context) error {
+			select {
+			case worker.turn <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			defer func() {
+				<-worker.turn
+			}()
+
+			return worker.worker(ctx)
+		}, worker.opts...)
+	})
+}
+
+// restart handles the failure of the worker, and waits for the backoff
+// if the restart is allowed. It returns false if the supervisor should
+// stop, in which case ctx is canceled with ErrTooManyRestarts if the
+// restarts exceed the limit.
+func (s *Supervisor) restart(ctx context.Context, cancel context.CancelCauseFunc, worker *supervisedWorker, err error, failures int) bool {
+	if !s.allowRestart(time.Now()) {
+		err = fmt.Errorf("%w: worker '%s' failed: %w", ErrTooManyRestarts, worker.name, err)
+		s.callHandlers(err, "supervisor: worker '%s' failed, giving up", worker.name)
+		cancel(err)
+
+		return false
+	}
+
+	s.callHandlers(err, "supervisor: worker '%s' failed, restarting", worker.name)
+
+	backoff := s.backoff(failures)
+	if backoff <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// allowRestart records a restart at now, and reports whether the number
+// of restarts within the window is still within the limit.
+func (s *Supervisor) allowRestart(now time.Time) bool {
+	if s.maxRestarts < 0 {
+		return true
+	}
+
+	s.restartsMutex.Lock()
+	defer s.restartsMutex.Unlock()
+
+	restarts := s.restarts[:0]
+	for _, restart := range s.restarts {
+		if now.Sub(restart) < s.window {
+			restarts = append(restarts, restart)
+		}
+	}
+
+	s.restarts = append(restarts, now)
+
+	return len(s.restarts) <= s.maxRestarts
+}
+
+// backoff returns the backoff before the restart after the consecutive
+// failures.
+func (s *Supervisor) backoff(failures int) time.Duration {
+	backoff := s.minBackoff
+	for i := 1; i < failures && backoff < s.maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, s.maxBackoff)
+}
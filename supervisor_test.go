@@ -0,0 +1,251 @@
+package fo
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// supervisorTestFailure is a failure passed to the handler of
+// recordingHandler(...).
+type supervisorTestFailure struct {
+	err     error
+	message string
+}
+
+func recordingHandler(recorder *testRecorder[supervisorTestFailure]) MayHandler {
+	return func(err error, messageArgs ...any) {
+		recorder.record(supervisorTestFailure{err: err, message: messageFromMsgAndArgs(messageArgs...)})
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	t.Parallel()
+
+	t.Run("OneForOne", func(t *testing.T) {
+		t.Parallel()
+
+		failures := &testRecorder[supervisorTestFailure]{}
+
+		var flakyRuns, stableRuns atomic.Int32
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		err := NewSupervisor(OneForOne).
+			Use(recordingHandler(failures)).
+			SetBackoff(time.Millisecond, 10*time.Millisecond).
+			Add("flaky", func(context.Context) error {
+				switch flakyRuns.Add(1) {
+				case 1:
+					return assert.AnError
+				case 2:
+					panic("something went wrong")
+				default:
+					cancel()
+					return nil
+				}
+			}).
+			Add("stable", func(ctx context.Context) error {
+				stableRuns.Add(1)
+				<-ctx.Done()
+
+				return ctx.Err()
+			}).
+			Run(ctx)
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(3), flakyRuns.Load())
+		assert.Equal(t, int32(1), stableRuns.Load())
+
+		handled := failures.snapshot()
+		require.Len(t, handled, 2)
+		assert.ErrorIs(t, handled[0].err, assert.AnError)
+		assert.Equal(t, "supervisor: worker 'flaky' failed, restarting", handled[0].message)
+
+		var panicErr *PanicError
+		require.ErrorAs(t, handled[1].err, &panicErr)
+		assert.Equal(t, "something went wrong", panicErr.Value)
+		assert.Equal(t, "supervisor: worker 'flaky' failed, restarting", handled[1].message)
+	})
+
+	t.Run("OneForAll", func(t *testing.T) {
+		t.Parallel()
+
+		var failingRuns, siblingRuns, oneShotRuns atomic.Int32
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		err := NewSupervisor(OneForAll).
+			SetBackoff(0, 0).
+			Add("one-shot", func(context.Context) error {
+				oneShotRuns.Add(1)
+				return nil
+			}).
+			Add("sibling", func(ctx context.Context) error {
+				siblingRuns.Add(1)
+				<-ctx.Done()
+
+				return ctx.Err()
+			}).
+			Add("failing", func(context.Context) error {
+				runs := failingRuns.Add(1)
+				for siblingRuns.Load() < runs {
+					time.Sleep(time.Millisecond)
+				}
+
+				time.Sleep(20 * time.Millisecond)
+
+				if runs < 3 {
+					return assert.AnError
+				}
+
+				cancel()
+
+				return nil
+			}).
+			Run(ctx)
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(3), failingRuns.Load())
+		assert.Equal(t, int32(3), siblingRuns.Load())
+		assert.Equal(t, int32(1), oneShotRuns.Load())
+	})
+
+	t.Run("Abandoned", func(t *testing.T) {
+		t.Parallel()
+
+		var running, maxRunning, stubbornRuns, failingRuns atomic.Int32
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		err := NewSupervisor(OneForAll).
+			SetBackoff(0, 0).
+			Add("stubborn", func(ctx context.Context) error {
+				stubbornRuns.Add(1)
+
+				current := running.Add(1)
+				defer running.Add(-1)
+
+				for {
+					peak := maxRunning.Load()
+					if current <= peak || maxRunning.CompareAndSwap(peak, current) {
+						break
+					}
+				}
+
+				// ignores the context, and is abandoned when the sibling fails
+				time.Sleep(30 * time.Millisecond)
+
+				if ctx.Err() == nil {
+					cancel()
+				}
+
+				return nil
+			}).
+			Add("failing", func(ctx context.Context) error {
+				if failingRuns.Add(1) >= 3 {
+					<-ctx.Done()
+					return nil
+				}
+
+				time.Sleep(5 * time.Millisecond)
+
+				return assert.AnError
+			}).
+			Run(ctx)
+		require.NoError(t, err)
+
+		assert.GreaterOrEqual(t, stubbornRuns.Load(), int32(2))
+		assert.Equal(t, int32(1), maxRunning.Load())
+	})
+
+	t.Run("Too many restarts", func(t *testing.T) {
+		t.Parallel()
+
+		failures := &testRecorder[supervisorTestFailure]{}
+
+		var runs atomic.Int32
+
+		err := NewSupervisor(OneForOne).
+			Use(recordingHandler(failures)).
+			SetMaxRestarts(2, time.Minute).
+			SetBackoff(0, 0).
+			Add("broken", func(context.Context) error {
+				runs.Add(1)
+				return assert.AnError
+			}).
+			Add("idle", func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}).
+			Run(context.Background())
+		require.ErrorIs(t, err, ErrTooManyRestarts)
+		require.ErrorIs(t, err, assert.AnError)
+
+		assert.Equal(t, int32(3), runs.Load())
+
+		handled := failures.snapshot()
+		assert.Equal(t, "supervisor: worker 'broken' failed, giving up", handled[len(handled)-1].message)
+	})
+
+	t.Run("Done", func(t *testing.T) {
+		t.Parallel()
+
+		err := NewSupervisor(OneForOne).
+			Add("done", func(context.Context) error {
+				return nil
+			}).
+			Run(context.Background())
+		require.NoError(t, err)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		t.Parallel()
+
+		var runs atomic.Int32
+
+		err := NewSupervisor(OneForOne).
+			SetMaxRestarts(1, time.Minute).
+			SetBackoff(0, 0).
+			Add("slow", func(ctx context.Context) error {
+				runs.Add(1)
+				<-ctx.Done()
+
+				return ctx.Err()
+			}, WithContextTimeout(10*time.Millisecond)).
+			Run(context.Background())
+		require.ErrorIs(t, err, ErrTooManyRestarts)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, int32(2), runs.Load())
+	})
+}
+
+func TestSupervisorBackoff(t *testing.T) {
+	t.Parallel()
+
+	s := NewSupervisor(OneForOne).SetBackoff(100*time.Millisecond, time.Second)
+
+	assert.Equal(t, 100*time.Millisecond, s.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, s.backoff(2))
+	assert.Equal(t, 800*time.Millisecond, s.backoff(4))
+	assert.Equal(t, time.Second, s.backoff(5))
+	assert.Equal(t, time.Second, s.backoff(100))
+
+	now := time.Now()
+
+	s.SetMaxRestarts(2, time.Second)
+	assert.True(t, s.allowRestart(now))
+	assert.True(t, s.allowRestart(now.Add(100*time.Millisecond)))
+	assert.False(t, s.allowRestart(now.Add(200*time.Millisecond)))
+	assert.True(t, s.allowRestart(now.Add(2*time.Second)))
+
+	s.SetMaxRestarts(-1, time.Second)
+	assert.True(t, s.allowRestart(now))
+}
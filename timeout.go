@@ -0,0 +1,70 @@
+package fo
+
+import (
+	"fmt"
+	"io"
+)
+
+// TimeoutError is the error returned by the invocations with
+// WithTimeoutStackCapture() when the context is done before the callback
+// function returns, along with the stack trace of the callback goroutine
+// at the time the caller left, which shows where the callback function
+// was blocked.
+type TimeoutError struct {
+	// Err is the error of the context, context.DeadlineExceeded or
+	// context.Canceled.
+	Err error
+	// GoroutineID is the ID of the callback goroutine.
+	GoroutineID int64
+	// Stack is the stack trace of the callback goroutine, it is empty if
+	// the callback goroutine has exited before the stack is captured.
+	Stack string
+}
+
+// Error implements the error interface, it returns the same message as
+// Err.
+func (e *TimeoutError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns Err, so that errors.Is(err, context.DeadlineExceeded)
+// still works.
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Format implements fmt.Formatter, the stack trace is printed with the
+// %+v verb.
+func (e *TimeoutError) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			_, _ = io.WriteString(s, e.Error())
+			if e.Stack != "" {
+				_, _ = fmt.Fprintf(s, "\n\n%s", e.Stack)
+			}
+
+			return
+		}
+
+		fallthrough
+	case 's':
+		_, _ = io.WriteString(s, e.Error())
+	case 'q':
+		_, _ = fmt.Fprintf(s, "%q", e.Error())
+	}
+}
+
+// newTimeoutError captures the stack trace of the callback goroutine
+// with the given ID and wraps err with it.
+func newTimeoutError(err error, goroutineID int64) *TimeoutError {
+	timeoutErr := &TimeoutError{
+		Err:         err,
+		GoroutineID: goroutineID,
+	}
+	if goroutineID != 0 {
+		timeoutErr.Stack = goroutineStacks()[goroutineID]
+	}
+
+	return timeoutErr
+}
@@ -0,0 +1,70 @@
+package fo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func blockedOnLockInTimeoutTest(mutex *sync.Mutex) {
+	mutex.Lock()
+	defer mutex.Unlock()
+}
+
+func TestTimeoutError(t *testing.T) {
+	t.Parallel()
+
+	err := &TimeoutError{Err: context.DeadlineExceeded, GoroutineID: 1, Stack: "goroutine 1 [running]:"}
+
+	assert.Equal(t, "context deadline exceeded", err.Error())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, "context deadline exceeded", fmt.Sprintf("%v", err))
+	assert.Equal(t, "context deadline exceeded", fmt.Sprintf("%s", err))
+	assert.Equal(t, `"context deadline exceeded"`, fmt.Sprintf("%q", err))
+	assert.Equal(t, "context deadline exceeded\n\ngoroutine 1 [running]:", fmt.Sprintf("%+v", err))
+
+	assert.Empty(t, newTimeoutError(context.Canceled, 0).Stack)
+}
+
+func TestWithTimeoutStackCapture(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Captured", func(t *testing.T) {
+		t.Parallel()
+
+		var mutex sync.Mutex
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		err := InvokeWith0(func() error {
+			blockedOnLockInTimeoutTest(&mutex)
+			return nil
+		}, WithContextTimeout(20*time.Millisecond), WithTimeoutStackCapture())
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		var timeoutErr *TimeoutError
+		require.ErrorAs(t, err, &timeoutErr)
+		assert.NotZero(t, timeoutErr.GoroutineID)
+		assert.Contains(t, timeoutErr.Stack, "blockedOnLockInTimeoutTest")
+		assert.Contains(t, timeoutErr.Stack, "sync.(*Mutex).Lock")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+
+		err := InvokeWith0(func() error {
+			time.Sleep(time.Second)
+			return nil
+		}, WithContextTimeout(10*time.Millisecond))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		var timeoutErr *TimeoutError
+		assert.NotErrorAs(t, err, &timeoutErr)
+	})
+}
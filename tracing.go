@@ -0,0 +1,434 @@
+package fo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	tracerScopeName = "github.com/nekomeowww/fo"
+	maySpanName     = "fo.may"
+)
+
+var (
+	spanExporterMutex  = sync.RWMutex{}
+	globalSpanExporter SpanExporter
+)
+
+// SetSpanExporter sets the global SpanExporter and enables the tracing
+// of every invocation and every error handled by May and May* functions,
+// passing nil disables the tracing. The spans of the invocations made
+// with the context passed to the context-aware callbacks are the children
+// of the outer ones, while the spans of May and May* functions are always
+// roots.
+//
+// NOTICE: This function will replace the global existing span exporter
+// on package fo level.
+func SetSpanExporter(exporter SpanExporter) {
+	spanExporterMutex.Lock()
+	defer spanExporterMutex.Unlock()
+
+	globalSpanExporter = exporter
+}
+
+func currentSpanExporter() SpanExporter {
+	spanExporterMutex.RLock()
+	defer spanExporterMutex.RUnlock()
+
+	return globalSpanExporter
+}
+
+// SpanStatusCode is the status code of a Span, the values are the same
+// as the ones of OpenTelemetry.
+type SpanStatusCode int
+
+const (
+	SpanStatusUnset SpanStatusCode = iota
+	SpanStatusOK
+	SpanStatusError
+)
+
+// SpanContext identifies a Span in a trace.
+type SpanContext struct {
+	// TraceID is the hex encoded 16 bytes trace ID.
+	TraceID string
+	// SpanID is the hex encoded 8 bytes span ID.
+	SpanID string
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying the SpanContext,
+// the spans of the invocations made with the returned context will be
+// the children of it. It can be used to link the spans to the traces of
+// other tracing systems.
+func ContextWithSpanContext(ctx context.Context, spanContext SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, spanContext)
+}
+
+// SpanContextFromContext returns the SpanContext carried by ctx.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	spanContext, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return spanContext, ok
+}
+
+// Span is a finished span of an invocation or of an error handled by May
+// and May* functions.
+type Span struct {
+	TraceID       string
+	SpanID        string
+	ParentSpanID  string
+	Name          string
+	Start         time.Time
+	End           time.Time
+	Attributes    map[string]any
+	Status        SpanStatusCode
+	StatusMessage string
+}
+
+// SpanExporter exports the finished spans. ExportSpan is called
+// synchronously when a span ends, implementations should be safe for
+// concurrent use and return quickly.
+type SpanExporter interface {
+	ExportSpan(span Span)
+}
+
+var (
+	_ SpanExporter = (*InMemorySpanExporter)(nil)
+	_ SpanExporter = (*OTLPFileExporter)(nil)
+)
+
+// InMemorySpanExporter keeps the exported spans in memory, it is meant
+// to be used in tests.
+type InMemorySpanExporter struct {
+	mutex sync.Mutex
+	spans []Span
+}
+
+// NewInMemorySpanExporter creates a new InMemorySpanExporter.
+func NewInMemorySpanExporter() *InMemorySpanExporter {
+	return &InMemorySpanExporter{
+		spans: make([]Span, 0),
+	}
+}
+
+// ExportSpan implements SpanExporter.
+func (e *InMemorySpanExporter) ExportSpan(span Span) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the exported spans in the order they ended.
+func (e *InMemorySpanExporter) Spans() []Span {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	spans := make([]Span, len(e.spans))
+	copy(spans, e.spans)
+
+	return spans
+}
+
+// Reset clears the exported spans.
+func (e *InMemorySpanExporter) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.spans = make([]Span, 0)
+}
+
+// OTLPFileExporter writes each exported span as a line of OTLP/JSON
+// ExportTraceServiceRequest, which can be imported by the OpenTelemetry
+// Collector with the otlpjsonfile receiver.
+type OTLPFileExporter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	closer io.Closer
+	err    error
+}
+
+// NewOTLPFileExporter creates a new OTLPFileExporter that writes to w.
+func NewOTLPFileExporter(w io.Writer) *OTLPFileExporter {
+	return &OTLPFileExporter{
+		writer: w,
+	}
+}
+
+// NewOTLPFileExporterFromPath creates a new OTLPFileExporter that appends
+// to the file at path. The file should be closed with Close().
+func NewOTLPFileExporterFromPath(path string) (*OTLPFileExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("otlp exporter: failed to open file: %w", err)
+	}
+
+	exporter := NewOTLPFileExporter(file)
+	exporter.closer = file
+
+	return exporter, nil
+}
+
+// Err returns the first error occurred while exporting.
+func (e *OTLPFileExporter) Err() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.err
+}
+
+// Close closes the underlying file if the exporter is created by
+// NewOTLPFileExporterFromPath, and returns the first error occurred
+// while exporting or closing.
+func (e *OTLPFileExporter) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closer != nil {
+		err := e.closer.Close()
+		if err != nil && e.err == nil {
+			e.err = err
+		}
+
+		e.closer = nil
+	}
+
+	return e.err
+}
+
+// ExportSpan implements SpanExporter.
+func (e *OTLPFileExporter) ExportSpan(span Span) {
+	line, err := json.Marshal(otlpRequestFromSpan(span))
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.err != nil {
+		return
+	}
+	if err != nil {
+		e.err = fmt.Errorf("otlp exporter: failed to encode span: %w", err)
+		return
+	}
+
+	_, e.err = e.writer.Write(append(line, '\n'))
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    SpanStatusCode `json:"code,omitempty"`
+	Message string         `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func otlpValue(value any) otlpAnyValue {
+	switch v := value.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int:
+		s := strconv.Itoa(v)
+		return otlpAnyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpAnyValue{IntValue: &s}
+	case float64:
+		return otlpAnyValue{DoubleValue: &v}
+	default:
+		s := fmt.Sprint(v)
+		return otlpAnyValue{StringValue: &s}
+	}
+}
+
+func otlpRequestFromSpan(span Span) otlpRequest {
+	keys := make([]string, 0, len(span.Attributes))
+	for key := range span.Attributes {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	attributes := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		attributes = append(attributes, otlpKeyValue{Key: key, Value: otlpValue(span.Attributes[key])})
+	}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: make([]otlpKeyValue, 0)},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: tracerScopeName},
+				Spans: []otlpSpan{{
+					TraceID:           span.TraceID,
+					SpanID:            span.SpanID,
+					ParentSpanID:      span.ParentSpanID,
+					Name:              span.Name,
+					Kind:              1, // SPAN_KIND_INTERNAL
+					StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+					EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+					Attributes:        attributes,
+					Status:            otlpStatus{Code: span.Status, Message: span.StatusMessage},
+				}},
+			}},
+		}},
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// activeSpan is a span that has not ended yet.
+type activeSpan struct {
+	exporter SpanExporter
+	span     Span
+}
+
+// startSpan starts a span as the child of the span carried by ctx, or
+// as a root span if there is none. It returns nil if the tracing is
+// disabled.
+func startSpan(ctx context.Context, name string, attributes map[string]any) *activeSpan {
+	exporter := currentSpanExporter()
+	if exporter == nil {
+		return nil
+	}
+
+	span := Span{
+		TraceID:    randomHex(16),
+		SpanID:     randomHex(8),
+		Name:       name,
+		Start:      time.Now(),
+		Attributes: attributes,
+	}
+
+	parent, ok := SpanContextFromContext(ctx)
+	if ok {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+	}
+
+	return &activeSpan{exporter: exporter, span: span}
+}
+
+// context returns the SpanContext of the span.
+func (s *activeSpan) context() SpanContext {
+	return SpanContext{TraceID: s.span.TraceID, SpanID: s.span.SpanID}
+}
+
+// end ends the span with the outcome and exports it.
+func (s *activeSpan) end(outcome string, err error) {
+	if s == nil {
+		return
+	}
+
+	s.span.End = time.Now()
+	s.span.Attributes["fo.outcome"] = outcome
+
+	if outcome == OutcomeOK {
+		s.span.Status = SpanStatusOK
+	} else {
+		s.span.Status = SpanStatusError
+		if err != nil {
+			s.span.StatusMessage = err.Error()
+		}
+	}
+
+	s.exporter.ExportSpan(s.span)
+}
+
+// startInvocationSpan starts the span of the invocation and returns the
+// context carrying it.
+func startInvocationSpan(ctx context.Context, call *invocation) (context.Context, *activeSpan) {
+	if currentSpanExporter() == nil {
+		return ctx, nil
+	}
+
+	attributes := map[string]any{
+		"fo.caller":  call.caller,
+		"fo.attempt": call.attempt,
+	}
+	if call.name != "" {
+		attributes["fo.name"] = call.name
+	}
+
+	deadline, ok := ctx.Deadline()
+	if ok {
+		attributes["fo.deadline"] = deadline.Format(time.RFC3339Nano)
+	}
+
+	span := startSpan(ctx, call.traceName(), attributes)
+	if span == nil {
+		return ctx, nil
+	}
+
+	return ContextWithSpanContext(ctx, span.context()), span
+}
+
+// exportMaySpan exports a span for the error handled by May and May*
+// functions. May takes no context, so the span is always the root of its
+// own trace.
+func exportMaySpan(err error, messageArgs ...any) {
+	span := startSpan(context.Background(), maySpanName, map[string]any{
+		"fo.may.message": messageFromMsgAndArgs(messageArgs...),
+	})
+
+	span.end(OutcomeError, err)
+}
@@ -0,0 +1,245 @@
+package fo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func spansNamed(spans []Span, prefix string) []Span {
+	filtered := make([]Span, 0)
+
+	for _, span := range spans {
+		if strings.HasPrefix(span.Name, prefix) {
+			filtered = append(filtered, span)
+		}
+	}
+
+	return filtered
+}
+
+func TestSpanContext(t *testing.T) {
+	t.Parallel()
+
+	_, ok := SpanContextFromContext(context.Background())
+	assert.False(t, ok)
+
+	ctx := ContextWithSpanContext(context.Background(), SpanContext{TraceID: "trace", SpanID: "span"})
+
+	spanContext, ok := SpanContextFromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, SpanContext{TraceID: "trace", SpanID: "span"}, spanContext)
+}
+
+func TestInvokeSpans(t *testing.T) {
+	exporter := NewInMemorySpanExporter()
+
+	SetSpanExporter(exporter)
+	defer SetSpanExporter(nil)
+
+	t.Run("Nested", func(t *testing.T) {
+		exporter.Reset()
+
+		res, err := InvokeWithContext(context.Background(), func(ctx context.Context) (string, error) {
+			return InvokeWithContext(ctx, func(ctx context.Context) (string, error) {
+				return "foo", nil
+			}, WithName("test.span.child"))
+		}, WithName("test.span.parent"))
+		require.NoError(t, err)
+		assert.Equal(t, "foo", res)
+
+		spans := spansNamed(exporter.Spans(), "test.span.")
+		require.Len(t, spans, 2)
+
+		child, parent := spans[0], spans[1]
+		assert.Equal(t, "test.span.child", child.Name)
+		assert.Equal(t, "test.span.parent", parent.Name)
+		assert.Empty(t, parent.ParentSpanID)
+		assert.Equal(t, parent.SpanID, child.ParentSpanID)
+		assert.Equal(t, parent.TraceID, child.TraceID)
+		assert.Len(t, parent.TraceID, 32)
+		assert.Len(t, parent.SpanID, 16)
+		assert.NotEqual(t, parent.SpanID, child.SpanID)
+
+		assert.Equal(t, SpanStatusOK, parent.Status)
+		assert.Equal(t, OutcomeOK, parent.Attributes["fo.outcome"])
+		assert.Equal(t, "test.span.parent", parent.Attributes["fo.name"])
+		assert.Equal(t, 1, parent.Attributes["fo.attempt"])
+		assert.Contains(t, parent.Attributes["fo.caller"], "fo.TestInvokeSpans.func1:")
+		assert.False(t, parent.End.Before(child.End))
+	})
+
+	t.Run("Remote parent", func(t *testing.T) {
+		exporter.Reset()
+
+		ctx := ContextWithSpanContext(context.Background(), SpanContext{
+			TraceID: "0af7651916cd43dd8448eb211c80319c",
+			SpanID:  "b7ad6b7169203331",
+		})
+
+		err := InvokeWithContext0(ctx, func(context.Context) error {
+			return nil
+		}, WithName("test.span.remote"))
+		require.NoError(t, err)
+
+		spans := spansNamed(exporter.Spans(), "test.span.")
+		require.Len(t, spans, 1)
+		assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", spans[0].TraceID)
+		assert.Equal(t, "b7ad6b7169203331", spans[0].ParentSpanID)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		exporter.Reset()
+
+		err := InvokeWith0(func() error {
+			return assert.AnError
+		}, WithName("test.span.error"))
+		require.Error(t, err)
+
+		_ = InvokeWith0(func() error {
+			time.Sleep(time.Second)
+			return nil
+		}, WithName("test.span.timeout"), WithContextTimeout(10*time.Millisecond))
+
+		spans := spansNamed(exporter.Spans(), "test.span.")
+		require.Len(t, spans, 2)
+
+		assert.Equal(t, SpanStatusError, spans[0].Status)
+		assert.Equal(t, OutcomeError, spans[0].Attributes["fo.outcome"])
+		assert.Equal(t, assert.AnError.Error(), spans[0].StatusMessage)
+
+		assert.Equal(t, SpanStatusError, spans[1].Status)
+		assert.Equal(t, OutcomeTimeout, spans[1].Attributes["fo.outcome"])
+		assert.Equal(t, context.DeadlineExceeded.Error(), spans[1].StatusMessage)
+		assert.Contains(t, spans[1].Attributes, "fo.deadline")
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		exporter.Reset()
+
+		_ = callWithPanicRecovery(func() error {
+			return InvokeWith0(func() error {
+				panic("something went wrong")
+			}, WithName("test.span.panic"))
+		})
+
+		spans := spansNamed(exporter.Spans(), "test.span.")
+		require.Len(t, spans, 1)
+		assert.Equal(t, OutcomePanic, spans[0].Attributes["fo.outcome"])
+		assert.Equal(t, "panic: something went wrong", spans[0].StatusMessage)
+	})
+
+	t.Run("May", func(t *testing.T) {
+		exporter.Reset()
+
+		may := NewMay[string]()
+		_ = may.Invoke("", errors.New("may failed"), "failed to %s", "foo")
+
+		spans := spansNamed(exporter.Spans(), maySpanName)
+		require.Len(t, spans, 1)
+		assert.Equal(t, SpanStatusError, spans[0].Status)
+		assert.Equal(t, "may failed", spans[0].StatusMessage)
+		assert.Equal(t, "failed to foo", spans[0].Attributes["fo.may.message"])
+		assert.Empty(t, spans[0].ParentSpanID)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		exporter.Reset()
+		SetSpanExporter(nil)
+		defer SetSpanExporter(exporter)
+
+		err := InvokeWith0(func() error {
+			return nil
+		}, WithName("test.span.disabled"))
+		require.NoError(t, err)
+
+		assert.Empty(t, spansNamed(exporter.Spans(), "test.span."))
+	})
+}
+
+func TestOTLPFileExporter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Writer", func(t *testing.T) {
+		t.Parallel()
+
+		buffer := new(bytes.Buffer)
+		exporter := NewOTLPFileExporter(buffer)
+
+		start := time.Unix(1, 0)
+
+		exporter.ExportSpan(Span{
+			TraceID:       "0af7651916cd43dd8448eb211c80319c",
+			SpanID:        "b7ad6b7169203331",
+			ParentSpanID:  "00f067aa0ba902b7",
+			Name:          "test.otlp",
+			Start:         start,
+			End:           start.Add(time.Second),
+			Attributes:    map[string]any{"fo.name": "test.otlp", "fo.attempt": 2, "flag": true, "ratio": 0.5, "other": time.Second},
+			Status:        SpanStatusError,
+			StatusMessage: "failed",
+		})
+		exporter.ExportSpan(Span{Name: "second", Start: start, End: start})
+		require.NoError(t, exporter.Err())
+		require.NoError(t, exporter.Close())
+
+		lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+		require.Len(t, lines, 2)
+
+		var request map[string]any
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &request))
+
+		resourceSpans, _ := request["resourceSpans"].([]any)
+		require.Len(t, resourceSpans, 1)
+
+		assert.JSONEq(t, `{
+			"resourceSpans": [{
+				"resource": {"attributes": []},
+				"scopeSpans": [{
+					"scope": {"name": "github.com/nekomeowww/fo"},
+					"spans": [{
+						"traceId": "0af7651916cd43dd8448eb211c80319c",
+						"spanId": "b7ad6b7169203331",
+						"parentSpanId": "00f067aa0ba902b7",
+						"name": "test.otlp",
+						"kind": 1,
+						"startTimeUnixNano": "1000000000",
+						"endTimeUnixNano": "2000000000",
+						"attributes": [
+							{"key": "flag", "value": {"boolValue": true}},
+							{"key": "fo.attempt", "value": {"intValue": "2"}},
+							{"key": "fo.name", "value": {"stringValue": "test.otlp"}},
+							{"key": "other", "value": {"stringValue": "1s"}},
+							{"key": "ratio", "value": {"doubleValue": 0.5}}
+						],
+						"status": {"code": 2, "message": "failed"}
+					}]
+				}]
+			}]
+		}`, lines[0])
+	})
+
+	t.Run("File", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "spans.jsonl")
+
+		exporter, err := NewOTLPFileExporterFromPath(path)
+		require.NoError(t, err)
+
+		exporter.ExportSpan(Span{Name: "test.otlp.file"})
+		require.NoError(t, exporter.Close())
+		require.NoError(t, exporter.Close())
+
+		_, err = NewOTLPFileExporterFromPath(filepath.Join(t.TempDir(), "missing", "spans.jsonl"))
+		require.Error(t, err)
+	})
+}
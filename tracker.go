@@ -0,0 +1,261 @@
+package fo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrShuttingDown is the error returned by the invocations registered
+	// with a Tracker that is shutting down, and the cause of the context
+	// of the callback functions canceled by Tracker.Shutdown(...).
+	ErrShuttingDown = errors.New("fo: shutting down")
+)
+
+var (
+	// errTrackerRejected is the ErrShuttingDown returned by the tracker
+	// rejecting the invocation, which tells the callback functions never
+	// called from the ones canceled by the shutdown while running.
+	errTrackerRejected = fmt.Errorf("%w", ErrShuttingDown)
+)
+
+var (
+	trackerMutex  = sync.RWMutex{}
+	globalTracker *Tracker
+)
+
+// SetTracker sets the global Tracker that every invocation registers
+// with, passing nil disables the global tracking.
+//
+// NOTICE: This function will replace the global existing tracker on
+// package fo level.
+func SetTracker(tracker *Tracker) {
+	trackerMutex.Lock()
+	defer trackerMutex.Unlock()
+
+	globalTracker = tracker
+}
+
+func currentTracker() *Tracker {
+	trackerMutex.RLock()
+	defer trackerMutex.RUnlock()
+
+	return globalTracker
+}
+
+// WithTracker registers the invocation with the tracker instead of the
+// global one set by SetTracker(...), which makes it possible to shut
+// down a scoped group of invocations.
+func WithTracker(tracker *Tracker) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeTracker,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				tracker:      tracker,
+				trackerIsSet: true,
+			}
+		},
+	}
+}
+
+// ShutdownReport is the report returned by Tracker.Shutdown(...).
+type ShutdownReport struct {
+	// Canceled is the number of the invocations whose context is canceled
+	// after the drain period.
+	Canceled int
+	// Remaining is the callback goroutines that are still running when
+	// Shutdown returns, including the abandoned ones.
+	Remaining []RunningInvocation
+}
+
+// trackedInvocation is an invocation registered with a Tracker.
+type trackedInvocation struct {
+	cancel  context.CancelCauseFunc
+	running atomic.Pointer[runningInvocation]
+}
+
+// Tracker tracks the callback goroutines of the invocations registered
+// with it, until they exit, to shut them down gracefully. Register the
+// invocations with SetTracker(...) globally, or with WithTracker(...)
+// per call:
+//
+//	tracker := fo.NewTracker(5 * time.Second)
+//	fo.SetTracker(tracker)
+//
+//	<-stop
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+//	defer cancel()
+//
+//	report, err := tracker.Shutdown(ctx)
+//	for _, invocation := range report.Remaining {
+//		log.Printf("%s from %s is still running", invocation.Name, invocation.Caller)
+//	}
+type Tracker struct {
+	drainPeriod time.Duration
+
+	mutex        sync.Mutex
+	invocations  map[*trackedInvocation]struct{}
+	shuttingDown bool
+	drained      chan struct{}
+}
+
+// NewTracker creates a new Tracker, the context of the callback functions
+// still running after the drain period since Shutdown is called will be
+// canceled with ErrShuttingDown as the cause, a non-positive drain period
+// cancels them right away.
+func NewTracker(drainPeriod time.Duration) *Tracker {
+	return &Tracker{
+		drainPeriod: drainPeriod,
+		invocations: make(map[*trackedInvocation]struct{}),
+		drained:     make(chan struct{}),
+	}
+}
+
+// InFlight returns the number of the callback goroutines registered with
+// the tracker that are still running.
+func (t *Tracker) InFlight() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return len(t.invocations)
+}
+
+// admit registers a new invocation with the tracker, and returns the
+// context for the invocation which is canceled by Shutdown after the
+// drain period. It returns ErrShuttingDown if the tracker is shutting
+// down. A nil tracker admits every invocation without tracking.
+func (t *Tracker) admit(ctx context.Context) (context.Context, *trackedInvocation, error) {
+	if t == nil {
+		return ctx, nil, nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.shuttingDown {
+		return ctx, nil, errTrackerRejected
+	}
+
+	tracked := &trackedInvocation{}
+	ctx, tracked.cancel = context.WithCancelCause(ctx)
+	t.invocations[tracked] = struct{}{}
+
+	return ctx, tracked, nil
+}
+
+// release unregisters the invocation once its callback goroutine exits.
+func (t *Tracker) release(tracked *trackedInvocation) {
+	if t == nil || tracked == nil {
+		return
+	}
+
+	tracked.cancel(context.Canceled)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.invocations, tracked)
+
+	if t.shuttingDown && len(t.invocations) == 0 {
+		t.closeDrained()
+	}
+}
+
+// closeDrained closes the drained channel if it is not closed yet, it
+// must be called with the mutex held.
+func (t *Tracker) closeDrained() {
+	select {
+	case <-t.drained:
+	default:
+		close(t.drained)
+	}
+}
+
+// Shutdown stops the tracker from accepting new invocations, which will
+// fail with ErrShuttingDown, and waits for the callback goroutines
+// registered with it to exit. The context of the callback functions
+// still running after the drain period will be canceled with
+// ErrShuttingDown as the cause, so that the context-aware ones can stop
+// early.
+//
+// It returns the report of the callback goroutines still running and the
+// error of ctx if ctx is done before all of them exit.
+func (t *Tracker) Shutdown(ctx context.Context) (ShutdownReport, error) {
+	t.mutex.Lock()
+	t.shuttingDown = true
+
+	if len(t.invocations) == 0 {
+		t.closeDrained()
+	}
+
+	t.mutex.Unlock()
+
+	var report ShutdownReport
+
+	drainTimer := time.NewTimer(t.drainPeriod)
+	defer drainTimer.Stop()
+
+	for {
+		select {
+		case <-t.drained:
+			return report, nil
+		case <-drainTimer.C:
+			report.Canceled = t.cancelAll()
+		case <-ctx.Done():
+			report.Remaining = t.remaining()
+			if len(report.Remaining) == 0 {
+				return report, nil
+			}
+
+			return report, ctx.Err()
+		}
+	}
+}
+
+// cancelAll cancels the context of all the invocations still running
+// and returns the number of them.
+func (t *Tracker) cancelAll() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for tracked := range t.invocations {
+		tracked.cancel(ErrShuttingDown)
+	}
+
+	return len(t.invocations)
+}
+
+// remaining returns the snapshots of the invocations still running.
+func (t *Tracker) remaining() []RunningInvocation {
+	t.mutex.Lock()
+
+	runnings := make([]*runningInvocation, 0, len(t.invocations))
+	for tracked := range t.invocations {
+		running := tracked.running.Load()
+		if running != nil {
+			runnings = append(runnings, running)
+		}
+	}
+
+	t.mutex.Unlock()
+
+	now := time.Now()
+	stacks := goroutineStacks()
+
+	remaining := make([]RunningInvocation, 0, len(runnings))
+	for _, running := range runnings {
+		remaining = append(remaining, running.snapshot(now, stacks))
+	}
+
+	sort.Slice(remaining, func(i, j int) bool {
+		return remaining[i].ID < remaining[j].ID
+	})
+
+	return remaining
+}
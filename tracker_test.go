@@ -0,0 +1,175 @@
+package fo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracker(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Drained", func(t *testing.T) {
+		t.Parallel()
+
+		tracker := NewTracker(time.Second)
+
+		res, err := InvokeWith(func() (string, error) {
+			return "foo", nil
+		}, WithTracker(tracker))
+		require.NoError(t, err)
+		assert.Equal(t, "foo", res)
+
+		started := make(chan struct{})
+
+		go func() {
+			_ = InvokeWith0(func() error {
+				close(started)
+				time.Sleep(50 * time.Millisecond)
+
+				return nil
+			}, WithTracker(tracker))
+		}()
+
+		<-started
+		assert.Equal(t, 1, tracker.InFlight())
+
+		report, err := tracker.Shutdown(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, report.Canceled)
+		assert.Empty(t, report.Remaining)
+		assert.Zero(t, tracker.InFlight())
+
+		_, err = InvokeWith(func() (string, error) {
+			return "foo", nil
+		}, WithTracker(tracker))
+		require.ErrorIs(t, err, ErrShuttingDown)
+
+		report, err = tracker.Shutdown(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, report.Remaining)
+	})
+
+	t.Run("Canceled after drain period", func(t *testing.T) {
+		t.Parallel()
+
+		tracker := NewTracker(20 * time.Millisecond)
+
+		started := make(chan struct{})
+		cause := make(chan error, 1)
+		returned := make(chan error, 1)
+
+		go func() {
+			returned <- InvokeWithContext0(context.Background(), func(ctx context.Context) error {
+				close(started)
+				<-ctx.Done()
+				cause <- context.Cause(ctx)
+
+				return ctx.Err()
+			}, WithTracker(tracker))
+		}()
+
+		<-started
+
+		report, err := tracker.Shutdown(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Canceled)
+		assert.Empty(t, report.Remaining)
+		assert.ErrorIs(t, <-cause, ErrShuttingDown)
+		assert.ErrorIs(t, <-returned, ErrShuttingDown)
+	})
+
+	t.Run("Slots held after canceled", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewRegistry()
+		r.Set("test.tracker.limited", Policy{ConcurrencyLimit: 1})
+
+		tracker := NewTracker(0)
+		started := make(chan struct{})
+		release := make(chan struct{})
+		returned := make(chan error, 1)
+
+		go func() {
+			returned <- InvokeWith0(func() error {
+				close(started)
+				// ignores the context
+				<-release
+
+				return nil
+			}, WithName("test.tracker.limited"), WithRegistry(r), WithTracker(tracker))
+		}()
+
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, _ = tracker.Shutdown(ctx)
+		require.ErrorIs(t, <-returned, ErrShuttingDown)
+
+		// the slot is held until the canceled callback function returns
+		err := InvokeWith0(func() error {
+			return nil
+		}, WithName("test.tracker.limited"), WithRegistry(r), WithContextTimeout(20*time.Millisecond))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		close(release)
+
+		assert.Eventually(t, func() bool {
+			return InvokeWith0(func() error { return nil }, WithName("test.tracker.limited"), WithRegistry(r)) == nil
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Remaining", func(t *testing.T) {
+		t.Parallel()
+
+		tracker := NewTracker(10 * time.Millisecond)
+
+		release := make(chan struct{})
+		defer close(release)
+
+		err := InvokeWith0(func() error {
+			<-release
+			return nil
+		}, WithName("test.tracker.stuck"), WithTracker(tracker), WithContextTimeout(10*time.Millisecond))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		report, err := tracker.Shutdown(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, 1, report.Canceled)
+		require.Len(t, report.Remaining, 1)
+		assert.Equal(t, "test.tracker.stuck", report.Remaining[0].Name)
+		assert.True(t, report.Remaining[0].Abandoned)
+		assert.Contains(t, report.Remaining[0].Stack, "TestTracker")
+	})
+}
+
+func TestSetTracker(t *testing.T) {
+	tracker := NewTracker(time.Second)
+
+	SetTracker(tracker)
+	defer SetTracker(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := tracker.Shutdown(ctx)
+	require.NoError(t, err)
+
+	_, err = Invoke(ctx, func() (string, error) {
+		return "foo", nil
+	})
+	require.ErrorIs(t, err, ErrShuttingDown)
+
+	_, err = InvokeWith(func() (string, error) {
+		return "foo", nil
+	}, WithTracker(nil))
+	require.NoError(t, err)
+}
@@ -0,0 +1,127 @@
+package fo
+
+import (
+	"context"
+	"time"
+)
+
+// WatchdogEvent is the event passed to the watchdog handler set by
+// WithWatchdog(...) while the callback function is still running.
+type WatchdogEvent struct {
+	// Name is the name of the invocation set by WithName(...).
+	Name string
+	// Caller is the call site of the invocation.
+	Caller string
+	// Start is the time when the callback function was started.
+	Start time.Time
+	// Elapsed is the duration since Start.
+	Elapsed time.Duration
+	// Deadline is the deadline of the invocation context, it is zero if
+	// there is none.
+	Deadline time.Time
+	// Remaining is the duration until Deadline, it is negative once the
+	// deadline is exceeded and zero if there is no deadline.
+	Remaining time.Duration
+	// Abandoned reports whether the caller has already left due to the
+	// context is done.
+	Abandoned bool
+	// Attempt is the attempt number of the invocation, starting from 1.
+	Attempt int
+	// GoroutineID is the ID of the callback goroutine.
+	GoroutineID int64
+}
+
+// Stack captures the current stack trace of the callback goroutine, it
+// returns an empty string if the callback goroutine has exited. It stops
+// the world briefly, so it is only captured on demand.
+func (e WatchdogEvent) Stack() string {
+	if e.GoroutineID == 0 {
+		return ""
+	}
+
+	return goroutineStacks()[e.GoroutineID]
+}
+
+// WatchdogHandler handles the periodic WatchdogEvent of a running
+// callback function.
+type WatchdogHandler func(event WatchdogEvent)
+
+// WithWatchdog calls handler every interval while the callback function
+// is still running, including after the caller has left due to the
+// context is done, to give visibility into long-running callbacks:
+//
+//	fo.InvokeWith0(job, fo.WithContextTimeout(30*time.Minute), fo.WithWatchdog(time.Minute, func(event fo.WatchdogEvent) {
+//		log.Printf("%s still running for %s, %s remaining", event.Name, event.Elapsed, event.Remaining)
+//	}))
+//
+// The handler is called in a separate goroutine and should return
+// quickly. A non-positive interval or a nil handler disables the
+// watchdog.
+func WithWatchdog(interval time.Duration, handler WatchdogHandler) CallInvokeWithOption {
+	return CallInvokeWithOption{
+		optionType: callInvokeWithOptionTypeWatchdog,
+		options: func() *invokeWithOptions {
+			return &invokeWithOptions{
+				watchdogInterval: interval,
+				watchdogHandler:  handler,
+				watchdogIsSet:    true,
+			}
+		},
+	}
+}
+
+// startWatchdog starts the watchdog of the running callback goroutine if
+// it is enabled, the returned function stops the watchdog and waits for
+// the in-flight handler call to return, so that the handler is never
+// called after the callback goroutine exits.
+func startWatchdog(ctx context.Context, call *invocation, running *runningInvocation) func() {
+	if call.watchdogInterval <= 0 || call.watchdogHandler == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+
+		ticker := time.NewTicker(call.watchdogInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				event := WatchdogEvent{
+					Name:        call.name,
+					Caller:      call.caller,
+					Start:       running.start,
+					Elapsed:     now.Sub(running.start),
+					Abandoned:   running.abandoned.Load(),
+					Attempt:     call.attempt,
+					GoroutineID: running.goroutineID.Load(),
+				}
+
+				deadline, ok := ctx.Deadline()
+				if ok {
+					event.Deadline = deadline
+					event.Remaining = deadline.Sub(now)
+				}
+
+				call.watchdogHandler(event)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}
+}
@@ -0,0 +1,102 @@
+package fo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// watchdogTestEvent is a watchdog event recorded by the handler of
+// recordingWatchdog(...) with the stack taken while handling it.
+type watchdogTestEvent struct {
+	WatchdogEvent
+
+	stack string
+}
+
+func recordingWatchdog(recorder *testRecorder[watchdogTestEvent]) func(event WatchdogEvent) {
+	return func(event WatchdogEvent) {
+		recorder.record(watchdogTestEvent{WatchdogEvent: event, stack: event.Stack()})
+	}
+}
+
+func sleepingInWatchdogTest(d time.Duration) {
+	time.Sleep(d)
+}
+
+func TestWithWatchdog(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Running", func(t *testing.T) {
+		t.Parallel()
+
+		recorder := &testRecorder[watchdogTestEvent]{}
+
+		err := InvokeWith0(func() error {
+			sleepingInWatchdogTest(120 * time.Millisecond)
+			return nil
+		}, WithName("test.watchdog"), WithContextTimeout(time.Second), WithWatchdog(20*time.Millisecond, recordingWatchdog(recorder)))
+		require.NoError(t, err)
+
+		events := recorder.snapshot()
+		require.GreaterOrEqual(t, len(events), 2)
+
+		assert.Contains(t, events[0].stack, "sleepingInWatchdogTest")
+
+		for _, event := range events {
+			assert.Equal(t, "test.watchdog", event.Name)
+			assert.Contains(t, event.Caller, "fo.TestWithWatchdog.func1:")
+			assert.Equal(t, 1, event.Attempt)
+			assert.False(t, event.Abandoned)
+			assert.False(t, event.Deadline.IsZero())
+			assert.Greater(t, event.Remaining, 800*time.Millisecond)
+			assert.LessOrEqual(t, event.Elapsed+event.Remaining, time.Second+10*time.Millisecond)
+		}
+
+		assert.Greater(t, events[1].Elapsed, events[0].Elapsed)
+
+		time.Sleep(50 * time.Millisecond)
+
+		after := recorder.snapshot()
+		assert.Len(t, after, len(events))
+	})
+
+	t.Run("Abandoned", func(t *testing.T) {
+		t.Parallel()
+
+		recorder := &testRecorder[watchdogTestEvent]{}
+
+		err := InvokeWith0(func() error {
+			sleepingInWatchdogTest(150 * time.Millisecond)
+			return nil
+		}, WithContextTimeout(30*time.Millisecond), WithWatchdog(20*time.Millisecond, recordingWatchdog(recorder)))
+		require.Error(t, err)
+
+		time.Sleep(200 * time.Millisecond)
+
+		events := recorder.snapshot()
+		require.NotEmpty(t, events)
+
+		last := events[len(events)-1]
+		assert.True(t, last.Abandoned)
+		assert.Negative(t, last.Remaining)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+
+		recorder := &testRecorder[watchdogTestEvent]{}
+
+		err := InvokeWith0(func() error {
+			time.Sleep(30 * time.Millisecond)
+			return nil
+		}, WithWatchdog(0, recordingWatchdog(recorder)))
+		require.NoError(t, err)
+
+		events := recorder.snapshot()
+		assert.Empty(t, events)
+		assert.Empty(t, WatchdogEvent{}.Stack())
+	})
+}